@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	mq "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+)
+
+// WriteResult acknowledges a set command on smh/<device>/set/<point>/result.
+type WriteResult struct {
+	Ts    int64    `json:"ts"`
+	Point string   `json:"point"`
+	Value *float64 `json:"value,omitempty"`
+	OK    bool     `json:"ok"`
+	Error string   `json:"error,omitempty"`
+}
+
+// subscribeCommands listens on smh/<device>/set/+ for every device that has
+// writable points. Commands arriving after ctx is cancelled are dropped.
+func (h *MainHandler) subscribeCommands(ctx context.Context, devices []deviceCfg) error {
+	for _, dev := range devices {
+		writable := false
+		for _, p := range dev.Map.Points {
+			writable = writable || p.Writable
+		}
+		if !writable {
+			continue
+		}
+		err := h.MQQTClient.SubscribeToTopic(mqttIface.Subscription{
+			Topic: "smh/" + dev.DeviceID + "/set/+",
+			QoS:   1,
+			Callback: func(_ mq.Client, m mq.Message) {
+				if ctx.Err() != nil {
+					return
+				}
+				id := m.Topic()[strings.LastIndex(m.Topic(), "/")+1:]
+				h.handleSet(dev, id, m.Payload())
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("subscribe %s: %w", dev.DeviceID, err)
+		}
+	}
+	return nil
+}
+
+func (h *MainHandler) handleSet(dev deviceCfg, id string, payload []byte) {
+	res := WriteResult{Ts: time.Now().Unix(), Point: id}
+	v, err := h.writePoint(dev, id, payload)
+	if err != nil {
+		slog.Warn("set failed", "device_id", dev.DeviceID, "point", id, "slave", dev.Slave, "err", err)
+		res.Error = err.Error()
+	} else {
+		res.OK = true
+		res.Value = &v
+	}
+	if err := h.publishEvent(dev.DeviceID, res, "/set/"+id+"/result"); err != nil {
+		slog.Error("publish set result", "device_id", dev.DeviceID, "point", id, "err", err)
+	}
+}
+
+func (h *MainHandler) writePoint(dev deviceCfg, id string, payload []byte) (float64, error) {
+	var point *modbus.Point
+	for i := range dev.Map.Points {
+		if dev.Map.Points[i].ID == id {
+			point = &dev.Map.Points[i]
+			break
+		}
+	}
+	if point == nil {
+		return 0, errors.New("unknown point")
+	}
+	if !point.Writable {
+		return 0, errors.New("point is not writable")
+	}
+
+	v, err := parseCommand(payload)
+	if err != nil {
+		return 0, err
+	}
+	if point.Min != nil && v < *point.Min {
+		return v, fmt.Errorf("value %v below min %v", v, *point.Min)
+	}
+	if point.Max != nil && v > *point.Max {
+		return v, fmt.Errorf("value %v above max %v", v, *point.Max)
+	}
+	if n := len(point.Options); n > 0 && (v != math.Trunc(v) || v < 0 || v >= float64(n)) {
+		return v, fmt.Errorf("value %v is not an option index in [0, %d)", v, n)
+	}
+
+	param := point.Param()
+	param.Slave = dev.Slave
+	return v, h.ModbusClient.WriteValue(param, v)
+}
+
+// parseCommand accepts a plain number or ON/OFF style booleans.
+func parseCommand(payload []byte) (float64, error) {
+	s := strings.TrimSpace(string(payload))
+	switch strings.ToLower(s) {
+	case "on", "true":
+		return 1, nil
+	case "off", "false":
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// subscribeRequests answers core on smh/<device>/request: "state" re-reads
+// and publishes the current state, "meta" re-announces the device.
+func (h *MainHandler) subscribeRequests(ctx context.Context, devices []deviceCfg) error {
+	for _, dev := range devices {
+		err := h.MQQTClient.SubscribeToTopic(mqttIface.Subscription{
+			Topic: "smh/" + dev.DeviceID + "/request",
+			QoS:   1,
+			Callback: func(_ mq.Client, m mq.Message) {
+				if ctx.Err() != nil {
+					return
+				}
+				h.handleRequest(dev, strings.TrimSpace(string(m.Payload())))
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("subscribe %s: %w", dev.DeviceID, err)
+		}
+	}
+	return nil
+}
+
+func (h *MainHandler) handleRequest(dev deviceCfg, req string) {
+	switch req {
+	case "state":
+		// publish every cap, not only the changed ones
+		if dev.report != nil {
+			dev.report.reset()
+		}
+		PublishOnce(*h, dev, time.Now().Unix())
+	case "meta":
+		h.announce([]deviceCfg{dev})
+	default:
+		slog.Warn("unknown request", "device_id", dev.DeviceID, "topic", "smh/"+dev.DeviceID+"/request", "request", req)
+	}
+}
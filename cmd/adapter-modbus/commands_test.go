@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	modbusMock "github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	mqttMock "github.com/tetragramaton/smh-go/internal/interface/mqtt/mock"
+	"github.com/tetragramaton/smh-go/internal/profile"
+)
+
+func TestHandleSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	maxLimit := 5000.0
+	dev := deviceCfg{DeviceID: "inv", Slave: 3, Map: modbus.RegMap{Points: []modbus.Point{
+		{ID: "limit", Cap: "number.power_limit", Addr: 0x3000, Scale: 10, Writable: true, Max: &maxLimit},
+		{ID: "voltage", Cap: "sensor.voltage", Addr: 0x2001, Scale: 10},
+		{ID: "mode", Cap: "select.work_mode", Addr: 0x3001, Writable: true, Options: []string{"auto", "manual", "off"}},
+	}}}
+
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().WriteValue(modbus.RegisterParam{
+		Slave: 3, Addr: 0x3000, Scale: 10, Function: modbus.FuncHolding,
+		Type: modbus.TypeInt16, Count: 1, Order: modbus.OrderABCD,
+	}, 2500.0).Return(nil)
+	mb.EXPECT().WriteValue(modbus.RegisterParam{
+		Slave: 3, Addr: 0x3001, Scale: 1, Function: modbus.FuncHolding,
+		Type: modbus.TypeInt16, Count: 1, Order: modbus.OrderABCD,
+	}, 2.0).Return(nil)
+
+	results := map[string]WriteResult{}
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		var r WriteResult
+		if err := json.Unmarshal(m.Payload, &r); err != nil {
+			t.Fatalf("bad result: %v", err)
+		}
+		results[m.Topic] = r
+		return nil
+	}).Times(7)
+
+	h := &MainHandler{MQQTClient: mq, ModbusClient: mb}
+	h.handleSet(dev, "limit", []byte("2500"))
+	h.handleSet(dev, "limit", []byte("9000"))
+	h.handleSet(dev, "voltage", []byte("230"))
+
+	if r := results["smh/inv/set/limit/result"]; r.OK || r.Error == "" {
+		t.Errorf("out of range write: %+v", r)
+	}
+	if r := results["smh/inv/set/voltage/result"]; r.OK || r.Error != "point is not writable" {
+		t.Errorf("read-only write: %+v", r)
+	}
+
+	// options take the index of a label, nothing else
+	for _, payload := range []string{"3", "1.5", "-1"} {
+		h.handleSet(dev, "mode", []byte(payload))
+		if r := results["smh/inv/set/mode/result"]; r.OK || r.Error == "" {
+			t.Errorf("option write %s: %+v", payload, r)
+		}
+	}
+	h.handleSet(dev, "mode", []byte("2"))
+	if r := results["smh/inv/set/mode/result"]; !r.OK {
+		t.Errorf("option write 2: %+v", r)
+	}
+}
+
+func TestHandleRequest_StatePublishesAllCaps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().ReadBatch(gomock.Any()).DoAndReturn(func(params []modbus.RegisterParam) []modbus.Reading {
+		return make([]modbus.Reading, len(params))
+	}).AnyTimes()
+
+	caps := map[string]int{}
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		var st map[string]any
+		if err := json.Unmarshal(m.Payload, &st); err != nil {
+			t.Fatalf("bad state: %v", err)
+		}
+		caps[st["cap"].(string)]++
+		return nil
+	}).AnyTimes()
+
+	regMap, err := profile.Builtin("CW100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := deviceCfg{DeviceID: "cw100.inverter", Slave: 1, Map: regMap, report: newReporter(time.Hour, 0)}
+	h := &MainHandler{MQQTClient: mq, ModbusClient: mb}
+
+	now := time.Now().Unix()
+	PublishOnce(*h, dev, now)
+	PublishOnce(*h, dev, now+1)
+	if len(caps) != 3 || caps["energy.meter"] != 1 {
+		t.Fatalf("unchanged values republished before the heartbeat: %v", caps)
+	}
+
+	h.handleRequest(dev, "unknown")
+	h.handleRequest(dev, "state")
+	for _, c := range []string{"sensor.frequency", "sensor.voltage", "energy.meter"} {
+		if caps[c] != 2 {
+			t.Errorf("%s published %d times, want 2", c, caps[c])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/health"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+)
+
+// activity tracks the last successful Modbus read and state publish. A nil
+// activity ignores updates.
+type activity struct {
+	started     time.Time
+	lastRead    atomic.Int64 // unix nanoseconds, 0 if none yet
+	lastPublish atomic.Int64
+}
+
+func newActivity() *activity {
+	return &activity{started: time.Now()}
+}
+
+func (a *activity) read() {
+	if a != nil {
+		a.lastRead.Store(time.Now().UnixNano())
+	}
+}
+
+func (a *activity) published() {
+	if a != nil {
+		a.lastPublish.Store(time.Now().UnixNano())
+	}
+}
+
+// age returns the time since ts, or since start if it never happened.
+func (a *activity) age(ts *atomic.Int64, now time.Time) (time.Duration, bool) {
+	if v := ts.Load(); v != 0 {
+		return now.Sub(time.Unix(0, v)), true
+	}
+	return now.Sub(a.started), false
+}
+
+// serveHTTP exposes /metrics, /healthz and /readyz on cfg.HTTPAddr.
+func (h *MainHandler) serveHTTP(ctx context.Context, cfg envCfg) {
+	stale := time.Duration(cfg.StaleSec) * time.Second
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.Handler(func() *health.Report { return h.health(stale, false) }))
+	mux.Handle("/readyz", health.Handler(func() *health.Report { return h.health(stale, true) }))
+	health.Serve(ctx, cfg.HTTPAddr, mux)
+}
+
+// health reports whether the adapter still reads the bus. Readiness also
+// requires both transports to be connected.
+func (h *MainHandler) health(stale time.Duration, ready bool) *health.Report {
+	r := health.NewReport()
+	now := time.Now()
+
+	age, ok := h.activity.age(&h.activity.lastRead, now)
+	detail := fmt.Sprintf("last successful read %v ago", age.Round(time.Millisecond))
+	if !ok {
+		detail = fmt.Sprintf("no successful read in %v", age.Round(time.Second))
+	}
+	r.Add("modbus_read", age <= stale, detail)
+
+	age, ok = h.activity.age(&h.activity.lastPublish, now)
+	detail = fmt.Sprintf("last state published %v ago", age.Round(time.Millisecond))
+	if !ok {
+		detail = "no state published yet"
+	}
+	// informational: report-by-exception may legitimately stay silent
+	r.Add("mqtt_publish", true, detail)
+
+	if ready {
+		r.Add("mqtt_connected", h.MQQTClient.IsConnectionOpen(), "")
+		r.Add("modbus_connected", h.ModbusClient.Connected(), "")
+	}
+	return r
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tetragramaton/smh-go/internal/health"
+	modbusMock "github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+	mqttMock "github.com/tetragramaton/smh-go/internal/interface/mqtt/mock"
+)
+
+func TestHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mq := mqttMock.NewMockClient(ctrl)
+	mb := modbusMock.NewMockClient(ctrl)
+	h := &MainHandler{MQQTClient: mq, ModbusClient: mb, activity: newActivity()}
+
+	status := func(ready bool) int {
+		rec := httptest.NewRecorder()
+		health.Handler(func() *health.Report { return h.health(time.Minute, ready) }).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// no read yet, but still within the grace period after start
+	if got := status(false); got != http.StatusOK {
+		t.Errorf("healthz after start: %d", got)
+	}
+
+	h.activity.started = time.Now().Add(-2 * time.Minute)
+	if got := status(false); got != http.StatusServiceUnavailable {
+		t.Errorf("healthz without reads: %d", got)
+	}
+
+	h.activity.read()
+	if got := status(false); got != http.StatusOK {
+		t.Errorf("healthz after read: %d", got)
+	}
+
+	mq.EXPECT().IsConnectionOpen().Return(true).Times(2)
+	mb.EXPECT().Connected().Return(true)
+	if got := status(true); got != http.StatusOK {
+		t.Errorf("readyz connected: %d", got)
+	}
+	mb.EXPECT().Connected().Return(false)
+	if got := status(true); got != http.StatusServiceUnavailable {
+		t.Errorf("readyz with modbus down: %d", got)
+	}
+}
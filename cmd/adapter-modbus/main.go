@@ -1,194 +1,215 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/tetragramaton/smh-go/internal/capability"
+	"github.com/tetragramaton/smh-go/internal/health"
 	"github.com/tetragramaton/smh-go/internal/interface/modbus"
 	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
-	"log"
+	"github.com/tetragramaton/smh-go/internal/logging"
+	"github.com/tetragramaton/smh-go/internal/profile"
+	"log/slog"
+	"math"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-type Meta struct {
-	DeviceID string   `json:"device_id"`
-	Model    string   `json:"model,omitempty"`
-	Area     string   `json:"area,omitempty"`
-	Caps     []string `json:"caps"`
-}
-
-type RegMap struct {
-	// Input/holding address and scaling for each metric
-	Frequency struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"` // raw / scale
-		Holding bool    `json:"holding"`
-	} `json:"frequency"`
-	Voltage struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"voltage"`
-	Power struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"power"`
-	Energy struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"energy"`
+// SensorState is one capability reading; Values holds the point fields
+// (e.g. "value", "power_w") and is flattened into the JSON object.
+// Coils and discrete inputs are published as booleans.
+type SensorState struct {
+	Ts     int64
+	Cap    string
+	Unit   string
+	Values map[string]any
 }
 
-type SensorState struct {
-	Ts        int64    `json:"ts"`
-	Cap       string   `json:"cap"`
-	Unit      string   `json:"unit,omitempty"`
-	Value     *float64 `json:"value,omitempty"`
-	PowerW    *float64 `json:"power_w,omitempty"`
-	EnergyKwh *float64 `json:"energy_kwh,omitempty"`
+func (s SensorState) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(s.Values)+3)
+	for k, v := range s.Values {
+		m[k] = v
+	}
+	m[capability.KeyTs] = s.Ts
+	m[capability.KeyCap] = s.Cap
+	if s.Unit != "" {
+		m[capability.KeyUnit] = s.Unit
+	}
+	return json.Marshal(m)
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := logging.Setup(); err != nil {
+		logging.Fatal("config", "err", err)
+	}
 	handler, err := InitMainHandler()
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("init", "err", err)
 	}
-	handler.Handle()
+	handler.Handle(ctx)
 }
 
-func (h *MainHandler) Handle() {
-	cfg := loadEnv()
-	defer h.MQQTClient.Disconnect(250)
+// Handle polls all devices until ctx is cancelled, then shuts down.
+func (h *MainHandler) Handle(ctx context.Context) {
+	cfg, err := loadEnv()
+	if err != nil {
+		logging.Fatal("config", "err", err)
+	}
+	defer h.shutdown(cfg.Devices, time.Duration(cfg.ShutdownSec)*time.Second)
+	h.activity = newActivity()
+	h.serveHTTP(ctx, cfg)
 
-	// announce meta
-	meta := Meta{
-		DeviceID: cfg.DeviceID,
-		Model:    cfg.Model,
-		Area:     cfg.Area,
-		Caps:     []string{"sensor.frequency", "sensor.voltage", "energy.meter"},
+	h.announce(cfg.Devices)
+
+	if err := h.subscribeCommands(ctx, cfg.Devices); err != nil {
+		slog.Error("subscribe commands", "err", err)
 	}
-	if err := h.publishEvent(cfg, meta, "/meta"); err != nil {
-		log.Printf("meta publish: %v", err)
+	if err := h.subscribeRequests(ctx, cfg.Devices); err != nil {
+		slog.Error("subscribe requests", "err", err)
 	}
 
-	defer func(ModbusClient modbus.Client) {
-		err := ModbusClient.Close()
+	online := h.ModbusClient.Connected()
+	h.publishAvailability(cfg.Devices, online)
+
+	// the broker may have lost retained messages and core its subscriptions
+	h.MQQTClient.OnReconnect(func() {
+		h.announce(cfg.Devices)
+		h.publishAvailability(cfg.Devices, h.ModbusClient.Connected())
+	})
+
+	sched := newScheduler(cfg.Devices, time.Duration(cfg.IntervalSec)*time.Second, time.Now())
+	sched.run(ctx, func(g *pollGroup, slot time.Time) {
+		publishPoints(*h, g.dev, g.points, slot)
+	}, func() {
+		if c := h.ModbusClient.Connected(); c != online {
+			online = c
+			h.publishAvailability(cfg.Devices, online)
+		}
+	})
+	slog.Info("shutting down")
+}
+
+// announce publishes the retained meta of every device, which makes core
+// (re)publish its Home Assistant discovery.
+func (h *MainHandler) announce(devices []deviceCfg) {
+	for _, dev := range devices {
+		meta := capability.Meta{
+			DeviceID:    dev.DeviceID,
+			Model:       dev.Model,
+			Area:        dev.Area,
+			Caps:        dev.Map.Caps(),
+			Points:      pointMeta(dev.Map),
+			PerCapState: dev.StateTopics != stateCombined,
+			Availability: []string{
+				"smh/" + dev.DeviceID + "/availability",
+				h.MQQTClient.StatusTopic(),
+			},
+		}
+		data, err := json.Marshal(meta)
 		if err != nil {
-			log.Printf("modbus client close: %v", err)
+			slog.Error("marshal meta", "device_id", dev.DeviceID, "err", err)
+			continue
 		}
-	}(h.ModbusClient)
-
-	ticker := time.NewTicker(time.Duration(cfg.IntervalSec) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			now := time.Now().Unix()
-			const statePath = "/state"
-			const errorLog = "publish event error: %v"
-
-			// frequency
-			freqParam := modbus.RegisterParam{
-				Addr:    cfg.MapCfg.Frequency.Addr,
-				Scale:   cfg.MapCfg.Frequency.Scale,
-				Holding: cfg.MapCfg.Frequency.Holding,
-			}
-			if v, err := h.readFloat(freqParam); err == nil {
-				state := SensorState{
-					Ts:    now,
-					Cap:   "sensor.frequency",
-					Value: round(v, 2),
-					Unit:  "Hz",
-				}
-				if err := h.publishEvent(cfg, state, statePath); err != nil {
-					log.Printf(errorLog, err)
-				}
-			} else {
-				log.Printf("read frequency: %v", err)
-			}
-
-			// voltage
-			voltParam := modbus.RegisterParam{
-				Addr:    cfg.MapCfg.Voltage.Addr,
-				Scale:   cfg.MapCfg.Voltage.Scale,
-				Holding: cfg.MapCfg.Voltage.Holding,
-			}
-			if v, err := h.readFloat(voltParam); err == nil {
-				state := SensorState{
-					Ts:    now,
-					Cap:   "sensor.voltage",
-					Value: round(v, 1),
-					Unit:  "V",
-				}
-				if err := h.publishEvent(cfg, state, statePath); err != nil {
-					log.Printf(errorLog, err)
-				}
-			} else {
-				log.Printf("read voltage: %v", err)
-			}
-
-			// power + energy (optional)
-			var pwPtr, ekPtr *float64
-			ok := false
-
-			if cfg.MapCfg.Power.Addr != 0 {
-				p := modbus.RegisterParam{
-					Addr:    cfg.MapCfg.Power.Addr,
-					Scale:   cfg.MapCfg.Power.Scale,
-					Holding: cfg.MapCfg.Power.Holding,
-				}
-				if v, err := h.readFloat(p); err == nil {
-					pwPtr = round(v, 1)
-					ok = true
-				} else {
-					log.Printf("read power: %v", err)
-				}
-			}
-
-			if cfg.MapCfg.Energy.Addr != 0 {
-				p := modbus.RegisterParam{
-					Addr:    cfg.MapCfg.Energy.Addr,
-					Scale:   cfg.MapCfg.Energy.Scale,
-					Holding: cfg.MapCfg.Energy.Holding,
-				}
-				if v, err := h.readFloat(p); err == nil {
-					ekPtr = round(v, 6)
-					ok = true
-				} else {
-					log.Printf("read energy: %v", err)
-				}
-			}
-
-			if ok {
-				state := SensorState{
-					Ts:        now,
-					Cap:       "energy.meter",
-					PowerW:    pwPtr,
-					EnergyKwh: ekPtr,
-				}
-				if err := h.publishEvent(cfg, state, statePath); err != nil {
-					log.Printf(errorLog, err)
-				}
-			}
+		if err := h.MQQTClient.PublishEvent(mqttIface.Message{
+			Topic:   "smh/" + dev.DeviceID + "/meta",
+			Payload: data,
+			QoS:     1,
+			Retain:  true,
+		}); err != nil {
+			slog.Error("publish meta", "device_id", dev.DeviceID, "err", err)
+		}
+	}
+}
+
+// shutdown marks the devices offline and closes both transports, giving up
+// after timeout so a hung broker or bus cannot block the exit.
+func (h *MainHandler) shutdown(devices []deviceCfg, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.publishAvailability(devices, false)
+		// waits for an in-flight read or write to finish
+		if err := h.ModbusClient.Close(); err != nil {
+			slog.Error("modbus client close", "err", err)
+		}
+		if err := h.MQQTClient.Close(250); err != nil {
+			slog.Error("mqtt client close", "err", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("shutdown timed out", "timeout", timeout)
+	}
+}
+
+// publishAvailability marks every device online or offline (retained) on
+// smh/<device>/availability, following the Modbus transport state.
+func (h *MainHandler) publishAvailability(devices []deviceCfg, online bool) {
+	payload := "offline"
+	if online {
+		payload = "online"
+	}
+	slog.Info("modbus transport", "state", payload, "devices", len(devices))
+	for _, dev := range devices {
+		if err := h.MQQTClient.PublishEvent(mqttIface.Message{
+			Topic:   "smh/" + dev.DeviceID + "/availability",
+			Payload: []byte(payload),
+			QoS:     1,
+			Retain:  true,
+		}); err != nil {
+			slog.Error("publish availability", "device_id", dev.DeviceID, "err", err)
 		}
 	}
 }
 
-func (h *MainHandler) publishEvent(cfg envCfg, payload any, path string) error {
+func pointMeta(m modbus.RegMap) []capability.PointMeta {
+	points := make([]capability.PointMeta, len(m.Points))
+	for i, p := range m.Points {
+		points[i] = capability.PointMeta{
+			ID:        p.ID,
+			Cap:       p.Cap,
+			Field:     p.StateField(),
+			Unit:      p.Unit,
+			Binary:    p.Function.IsBit(),
+			Writable:  p.Writable,
+			Precision: p.Precision,
+			Min:       p.Min,
+			Max:       p.Max,
+			Options:   p.Options,
+		}
+		if p.Writable && !p.Function.IsBit() && len(p.Options) == 0 {
+			// Home Assistant numbers default to 1..100 otherwise
+			lo, hi := p.WriteRange()
+			points[i].Min, points[i].Max = &lo, &hi
+		}
+	}
+	return points
+}
+
+func (h *MainHandler) publishEvent(deviceID string, payload any, path string) error {
+	return h.publish(deviceID, payload, path, false)
+}
+
+func (h *MainHandler) publish(deviceID string, payload any, path string, retain bool) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 	return h.MQQTClient.PublishEvent(mqttIface.Message{
-		Topic:   "smh/" + cfg.DeviceID + path,
+		Topic:   "smh/" + deviceID + path,
 		Payload: data,
 		QoS:     1,
-		Retain:  false,
+		Retain:  retain,
 	})
 }
 
@@ -196,11 +217,37 @@ func (h *MainHandler) readFloat(p modbus.RegisterParam) (float64, error) {
 	return h.ModbusClient.ReadFloat(p)
 }
 
+func (h *MainHandler) readBatch(params []modbus.RegisterParam) []modbus.Reading {
+	return h.ModbusClient.ReadBatch(params)
+}
+
+// deviceCfg is one logical device polled over the shared bus.
+type deviceCfg struct {
+	DeviceID string        `json:"device_id"`
+	Model    string        `json:"model,omitempty"`
+	Area     string        `json:"area,omitempty"`
+	Slave    byte          `json:"slave,omitempty"`    // MODBUS_SLAVE_ID if zero
+	Map      modbus.RegMap `json:"map"`                // see resolveMap if empty
+	MapFile  string        `json:"map_file,omitempty"` // YAML or JSON profile
+	// StateTopics is the state topic layout, STATE_TOPICS if empty.
+	StateTopics string `json:"state_topics,omitempty"`
+	// Report-by-exception defaults of the points, HEARTBEAT_SEC and
+	// MIN_PUBLISH_INTERVAL_SEC if zero.
+	HeartbeatSec   int `json:"heartbeat_sec,omitempty"`
+	MinIntervalSec int `json:"min_interval_sec,omitempty"`
+
+	report *reporter
+}
+
+// State topic layouts.
+const (
+	stateCombined = "combined" // every cap on smh/<device>/state
+	statePerCap   = "per_cap"  // smh/<device>/<cap>/state, retained
+	stateBoth     = "both"
+)
+
 type envCfg struct {
-	MQTTURL  string
-	DeviceID string
-	Model    string
-	Area     string
+	MQTTURL string
 
 	Mode string // "rtu" or "tcp"
 	// RTU
@@ -216,10 +263,13 @@ type envCfg struct {
 	TCPAddr string // "192.168.1.10:502"
 
 	IntervalSec int
-	MapCfg      RegMap
+	HTTPAddr    string // metrics and health listener, disabled if empty
+	StaleSec    int    // read age after which /healthz fails
+	ShutdownSec int
+	Devices     []deviceCfg
 }
 
-func loadEnv() envCfg {
+func loadEnv() (envCfg, error) {
 	get := func(k, def string) string {
 		if v := os.Getenv(k); v != "" {
 			return v
@@ -235,9 +285,6 @@ func loadEnv() envCfg {
 
 	cfg := envCfg{
 		MQTTURL:     get("MQTT_URL", "tcp://mqtt:1883"),
-		DeviceID:    get("DEVICE_ID", "cw100.inverter"),
-		Model:       get("MODEL", "CW100"),
-		Area:        get("AREA", "lab"),
 		Mode:        strings.ToLower(get("MODBUS_MODE", "rtu")),
 		Port:        get("MODBUS_PORT", "/dev/ttyUSB0"),
 		Baud:        atoi(get("MODBUS_BAUD", "9600"), 9600),
@@ -248,57 +295,84 @@ func loadEnv() envCfg {
 		TimeoutMs:   atoi(get("MODBUS_TIMEOUT_MS", "500"), 500),
 		TCPAddr:     get("MODBUS_TCP_ADDR", "127.0.0.1:502"),
 		IntervalSec: atoi(get("INTERVAL_SEC", "1"), 1),
+		HTTPAddr:    health.Addr(),
+		StaleSec:    atoi(get("HEALTH_STALE_SEC", "60"), 60),
+		ShutdownSec: atoi(get("SHUTDOWN_TIMEOUT_SEC", "5"), 5),
 	}
 
-	// register map (default CW100-like)
-	cfg.MapCfg.Frequency = struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	}(struct {
-		Addr    uint16
-		Scale   float64
-		Holding bool
-	}{Addr: 0x2000, Scale: 100.0, Holding: true})
-	cfg.MapCfg.Voltage = struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	}(struct {
-		Addr    uint16
-		Scale   float64
-		Holding bool
-	}{Addr: 0x2001, Scale: 10.0, Holding: true})
-	cfg.MapCfg.Power = struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	}(struct {
-		Addr    uint16
-		Scale   float64
-		Holding bool
-	}{Addr: 0x2003, Scale: 1.0, Holding: true})
-	cfg.MapCfg.Energy = struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	}(struct {
-		Addr    uint16
-		Scale   float64
-		Holding bool
-	}{Addr: 0x2004, Scale: 100.0, Holding: true})
-
-	// optional JSON override via MODBUS_MAP_JSON
-	if js := os.Getenv("MODBUS_MAP_JSON"); js != "" {
-		var m RegMap
-		if err := json.Unmarshal([]byte(js), &m); err == nil {
-			cfg.MapCfg = m
-		} else {
-			log.Printf("WARN: bad MODBUS_MAP_JSON: %v", err)
+	// several devices on one bus via MODBUS_DEVICES_JSON, otherwise a
+	// single device described by DEVICE_ID, MODEL and AREA
+	cfg.Devices = []deviceCfg{{
+		DeviceID: get("DEVICE_ID", "cw100.inverter"),
+		Model:    get("MODEL", "CW100"),
+		Area:     get("AREA", "lab"),
+	}}
+	if js := os.Getenv("MODBUS_DEVICES_JSON"); js != "" {
+		var devs []deviceCfg
+		if err := json.Unmarshal([]byte(js), &devs); err != nil {
+			return cfg, fmt.Errorf("bad MODBUS_DEVICES_JSON: %w", err)
+		}
+		cfg.Devices = devs
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Devices {
+		dev := &cfg.Devices[i]
+		if err := capability.CheckID(dev.DeviceID); err != nil {
+			return cfg, fmt.Errorf("device %d: device_id %w", i, err)
+		}
+		if seen[dev.DeviceID] {
+			return cfg, fmt.Errorf("device %d: duplicate device_id %q", i, dev.DeviceID)
+		}
+		seen[dev.DeviceID] = true
+		if dev.Slave == 0 {
+			dev.Slave = byte(cfg.SlaveID)
+		}
+		if dev.StateTopics == "" {
+			dev.StateTopics = get("STATE_TOPICS", stateCombined)
+		}
+		switch dev.StateTopics {
+		case stateCombined, statePerCap, stateBoth:
+		default:
+			return cfg, fmt.Errorf("device %s: unknown state topics %q", dev.DeviceID, dev.StateTopics)
+		}
+		if dev.HeartbeatSec == 0 {
+			dev.HeartbeatSec = atoi(get("HEARTBEAT_SEC", "0"), 0)
+		}
+		if dev.MinIntervalSec == 0 {
+			dev.MinIntervalSec = atoi(get("MIN_PUBLISH_INTERVAL_SEC", "0"), 0)
+		}
+		dev.report = newReporter(time.Duration(dev.HeartbeatSec)*time.Second,
+			time.Duration(dev.MinIntervalSec)*time.Second)
+		if err := resolveMap(dev); err != nil {
+			return cfg, fmt.Errorf("device %s: %w", dev.DeviceID, err)
 		}
 	}
 
-	return cfg
+	return cfg, nil
+}
+
+// resolveMap fills and validates the register map of dev, taking the first
+// of: inline map, map_file, MODBUS_MAP_FILE, MODBUS_MAP_JSON and the
+// built-in profile for the device model.
+func resolveMap(dev *deviceCfg) error {
+	var err error
+	switch {
+	case len(dev.Map.Points) > 0:
+		profile.ApplyDefaults(&dev.Map)
+		return profile.Validate(dev.Map)
+	case dev.MapFile != "":
+		dev.Map, err = profile.Load(dev.MapFile)
+	case os.Getenv("MODBUS_MAP_FILE") != "":
+		dev.Map, err = profile.Load(os.Getenv("MODBUS_MAP_FILE"))
+	case os.Getenv("MODBUS_MAP_JSON") != "":
+		dev.Map, err = profile.Parse([]byte(os.Getenv("MODBUS_MAP_JSON")))
+		if err != nil {
+			err = fmt.Errorf("MODBUS_MAP_JSON: %w", err)
+		}
+	default:
+		dev.Map, err = profile.Builtin(dev.Model)
+	}
+	return err
 }
 
 func must(b []byte, err error) []byte {
@@ -308,11 +382,7 @@ func must(b []byte, err error) []byte {
 	return b
 }
 
-func round(v float64, prec int) *float64 {
-	p := 1.0
-	for i := 0; i < prec; i++ {
-		p *= 10
-	}
-	r := float64(int(v*p+0.5)) / p
-	return &r
+func round(v float64, prec int) float64 {
+	p := math.Pow10(prec)
+	return math.Round(v*p) / p
 }
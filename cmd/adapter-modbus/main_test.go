@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	modbusMock "github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	mqttMock "github.com/tetragramaton/smh-go/internal/interface/mqtt/mock"
+)
+
+func TestHandle_ShutsDownOnCancel(t *testing.T) {
+	t.Setenv("DEVICE_ID", "inv")
+	ctrl := gomock.NewController(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().Connected().Return(true)
+	closeModbus := mb.EXPECT().Close().Return(nil)
+
+	var availability []string
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().StatusTopic().Return("smh/adapter/status").AnyTimes()
+	mq.EXPECT().OnReconnect(gomock.Any())
+	mq.EXPECT().SubscribeToTopic(gomock.Any()).Return(nil).AnyTimes()
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		if m.Topic == "smh/inv/availability" {
+			availability = append(availability, string(m.Payload))
+		}
+		return nil
+	}).AnyTimes()
+	mq.EXPECT().Close(uint(250)).Return(nil).After(closeModbus)
+
+	h := &MainHandler{MQQTClient: mq, ModbusClient: mb}
+	h.Handle(ctx)
+
+	if len(availability) != 2 || availability[0] != "online" || availability[1] != "offline" {
+		t.Fatalf("unexpected availability sequence %v", availability)
+	}
+}
+
+func TestPointMeta_WriteRange(t *testing.T) {
+	maxLimit := 5000.0
+	points := pointMeta(modbus.RegMap{Points: []modbus.Point{
+		{ID: "limit", Cap: "number.power_limit", Type: modbus.TypeUint16, Scale: 10, Writable: true},
+		{ID: "bounded", Cap: "number.power_limit", Scale: 10, Writable: true, Max: &maxLimit},
+		{ID: "mode", Cap: "select.mode", Writable: true, Options: []string{"off", "on"}},
+		{ID: "voltage", Cap: "sensor.voltage"},
+	}})
+
+	want := [][2]float64{{0, 6553.5}, {-3276.8, 5000}}
+	for i, w := range want {
+		p := points[i]
+		if p.Min == nil || p.Max == nil || *p.Min != w[0] || *p.Max != w[1] {
+			t.Errorf("%s: range %v..%v, want %v..%v", p.ID, p.Min, p.Max, w[0], w[1])
+		}
+	}
+	for _, p := range points[2:] {
+		if p.Min != nil || p.Max != nil {
+			t.Errorf("%s: unexpected range %v..%v", p.ID, *p.Min, *p.Max)
+		}
+	}
+}
+
+func TestLoadEnv_Devices(t *testing.T) {
+	t.Setenv("MODBUS_SLAVE_ID", "7")
+	t.Setenv("MODBUS_DEVICES_JSON", `[
+		{"device_id": "meter", "model": "SDM120"},
+		{"device_id": "relay", "slave": 2, "map": {"points": [
+			{"id": "ch1", "cap": "switch.relay", "addr": 0, "function": "coil", "writable": true}
+		]}}
+	]`)
+
+	cfg, err := loadEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Devices) != 2 {
+		t.Fatalf("got %d devices", len(cfg.Devices))
+	}
+	meter, relay := cfg.Devices[0], cfg.Devices[1]
+	if meter.Slave != 7 || relay.Slave != 2 {
+		t.Errorf("slaves %d and %d, want 7 and 2", meter.Slave, relay.Slave)
+	}
+	if len(meter.Map.Points) < 2 || len(relay.Map.Points) != 1 || relay.Map.Points[0].ID != "ch1" {
+		t.Fatalf("maps not resolved per device: %+v, %+v", meter.Map, relay.Map)
+	}
+
+	ctrl := gomock.NewController(t)
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().ReadBatch(gomock.Any()).DoAndReturn(func(params []modbus.RegisterParam) []modbus.Reading {
+		return make([]modbus.Reading, len(params))
+	}).Times(2)
+	topics := map[string]bool{}
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		topics[m.Topic] = true
+		return nil
+	}).AnyTimes()
+
+	h := MainHandler{MQQTClient: mq, ModbusClient: mb}
+	for _, dev := range cfg.Devices {
+		PublishOnce(h, dev, 1700000000)
+	}
+	if !topics["smh/meter/state"] || !topics["smh/relay/state"] || len(topics) != 2 {
+		t.Errorf("unexpected state topics %v", topics)
+	}
+}
+
+func TestLoadEnv_RejectsDuplicateDevices(t *testing.T) {
+	t.Setenv("MODBUS_DEVICES_JSON", `[{"device_id": "meter", "slave": 1}, {"device_id": "meter", "slave": 2}]`)
+	if _, err := loadEnv(); err == nil {
+		t.Fatal("expected error for duplicate device_id")
+	}
+}
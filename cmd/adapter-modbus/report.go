@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+// reporter remembers the last published value of every point of a device
+// so unchanged values are not republished on every poll
+// (report-by-exception), and the last read value so caps whose points are
+// polled at different rates are always published complete.
+type reporter struct {
+	heartbeat   time.Duration // device default, see modbus.Point.HeartbeatSec
+	minInterval time.Duration // device default, see modbus.Point.MinIntervalSec
+
+	mu     sync.Mutex
+	last   map[string]published
+	values map[string]float64
+}
+
+type published struct {
+	value float64
+	at    time.Time
+}
+
+func newReporter(heartbeat, minInterval time.Duration) *reporter {
+	return &reporter{
+		heartbeat:   heartbeat,
+		minInterval: minInterval,
+		last:        map[string]published{},
+		values:      map[string]float64{},
+	}
+}
+
+// due reports whether v must be published for p at now. Without a heartbeat
+// or deadband every poll is published.
+func (r *reporter) due(p modbus.Point, v float64, now time.Time) bool {
+	r.mu.Lock()
+	last, ok := r.last[p.ID]
+	r.mu.Unlock()
+	if !ok {
+		return true
+	}
+
+	heartbeat, minInterval := r.heartbeat, r.minInterval
+	if p.HeartbeatSec > 0 {
+		heartbeat = time.Duration(p.HeartbeatSec) * time.Second
+	}
+	if p.MinIntervalSec > 0 {
+		minInterval = time.Duration(p.MinIntervalSec) * time.Second
+	}
+	since := now.Sub(last.at)
+	switch {
+	case since < minInterval:
+		return false
+	case heartbeat == 0 && p.Deadband == 0 && p.DeadbandPct == 0:
+		return true
+	case heartbeat > 0 && since >= heartbeat:
+		return true
+	}
+	return changed(p, last.value, v)
+}
+
+// changed reports a change beyond the point deadband, or any change if it
+// has none.
+func changed(p modbus.Point, last, v float64) bool {
+	diff := math.Abs(v - last)
+	if p.Deadband == 0 && p.DeadbandPct == 0 {
+		return diff != 0
+	}
+	if p.Deadband > 0 && diff >= p.Deadband {
+		return true
+	}
+	return p.DeadbandPct > 0 && diff >= math.Abs(last)*p.DeadbandPct/100 && diff != 0
+}
+
+// published records that v was published for p at now.
+func (r *reporter) published(p modbus.Point, v float64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last[p.ID] = published{value: v, at: now}
+}
+
+// read records the latest reading of p.
+func (r *reporter) read(p modbus.Point, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[p.ID] = v
+}
+
+// lastRead returns the latest reading of p.
+func (r *reporter) lastRead(p modbus.Point) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.values[p.ID]
+	return v, ok
+}
+
+// reset forgets the published values so the next poll publishes everything,
+// e.g. when core requests the current state.
+func (r *reporter) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.last)
+}
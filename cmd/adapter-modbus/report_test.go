@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+func TestReporter_Due(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	cases := []struct {
+		name  string
+		r     *reporter
+		p     modbus.Point
+		v     float64
+		after time.Duration
+		want  bool
+	}{
+		{"legacy publishes every poll", newReporter(0, 0), modbus.Point{}, 230, time.Second, true},
+		{"unchanged within heartbeat", newReporter(time.Minute, 0), modbus.Point{}, 230, time.Second, false},
+		{"any change without deadband", newReporter(time.Minute, 0), modbus.Point{}, 230.1, time.Second, true},
+		{"heartbeat elapsed", newReporter(time.Minute, 0), modbus.Point{}, 230, time.Minute, true},
+		{"inside absolute deadband", newReporter(0, 0), modbus.Point{Deadband: 1}, 230.5, time.Second, false},
+		{"outside absolute deadband", newReporter(0, 0), modbus.Point{Deadband: 1}, 231, time.Second, true},
+		{"inside percent deadband", newReporter(0, 0), modbus.Point{DeadbandPct: 1}, 232, time.Second, false},
+		{"outside percent deadband", newReporter(0, 0), modbus.Point{DeadbandPct: 1}, 233, time.Second, true},
+		{"point heartbeat overrides", newReporter(time.Hour, 0), modbus.Point{HeartbeatSec: 10}, 230, 10 * time.Second, true},
+		{"min interval holds back changes", newReporter(0, 5*time.Second), modbus.Point{}, 240, time.Second, false},
+		{"min interval passed", newReporter(0, 5*time.Second), modbus.Point{}, 240, 5 * time.Second, true},
+	}
+	for _, c := range cases {
+		c.p.ID = "voltage"
+		if !c.r.due(c.p, 230, t0) {
+			t.Fatalf("%s: first value must be due", c.name)
+		}
+		c.r.published(c.p, 230, t0)
+		if got := c.r.due(c.p, c.v, t0.Add(c.after)); got != c.want {
+			t.Errorf("%s: due = %v, want %v", c.name, got, c.want)
+		}
+		c.r.reset()
+		if !c.r.due(c.p, c.v, t0.Add(c.after)) {
+			t.Errorf("%s: value not due after reset", c.name)
+		}
+	}
+}
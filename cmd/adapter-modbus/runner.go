@@ -2,7 +2,10 @@ package main
 
 import (
 	"github.com/tetragramaton/smh-go/internal/interface/modbus"
-	"log"
+	"github.com/tetragramaton/smh-go/internal/logging"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+	"log/slog"
+	"time"
 
 	//"encoding/json"
 	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
@@ -13,90 +16,130 @@ type mqttClient interface {
 	mqttIface.API
 }
 
+// pollErrors deduplicates read and publish errors repeating on every poll.
+var pollErrors = logging.NewLimiter(time.Minute)
+
 // PublishOnce reads mapped registers and publishes normalized states once.
-// Used by tests; the main loop uses similar logic on a ticker.
-func PublishOnce(h MainHandler, cfg envCfg, now int64) {
-	// frequency
-	freqParam := modbus.RegisterParam{
-		Addr:    cfg.MapCfg.Frequency.Addr,
-		Scale:   cfg.MapCfg.Frequency.Scale,
-		Holding: cfg.MapCfg.Frequency.Holding,
-	}
-	const path = "/state"
-	if v, err := h.readFloat(freqParam); err == nil {
-		sensorState := SensorState{
-			Ts:    now,
-			Cap:   "sensor.frequency",
-			Unit:  "Hz",
-			Value: round(v, 2),
+// Points sharing a capability are merged into a single state message. With
+// a reporter only caps with at least one due point are published, always
+// with all their fields.
+func PublishOnce(h MainHandler, dev deviceCfg, now int64) {
+	publishPoints(h, dev, dev.Map.Points, time.Unix(now, 0))
+}
+
+// publishPoints reads points, a subset of the device map polled together,
+// and publishes their caps. Fields of those caps polled at another rate are
+// filled with their last reading.
+func publishPoints(h MainHandler, dev deviceCfg, points []modbus.Point, at time.Time) {
+	var states []*SensorState
+	byCap := map[string]*SensorState{}
+	due := map[string]bool{}
+	polled := map[string]bool{}
+	add := func(p modbus.Point, v float64) {
+		st, ok := byCap[p.Cap]
+		if !ok {
+			st = &SensorState{Ts: at.Unix(), Cap: p.Cap, Unit: p.Unit, Values: map[string]any{}}
+			byCap[p.Cap] = st
+			states = append(states, st)
+		} else if st.Unit != p.Unit {
+			// mixed units (e.g. W + kWh) are carried by the field names
+			st.Unit = ""
 		}
-		err := h.publishEvent(cfg, sensorState, path)
-		if err != nil {
-			log.Printf("Error publishing sensor state: %v", err)
+		if p.Function.IsBit() {
+			st.Values[p.StateField()] = v != 0
+		} else {
+			st.Values[p.StateField()] = v
 		}
 	}
-	// voltage
-	voltParam := modbus.RegisterParam{
-		Addr:    cfg.MapCfg.Voltage.Addr,
-		Scale:   cfg.MapCfg.Voltage.Scale,
-		Holding: cfg.MapCfg.Voltage.Holding,
+
+	params := make([]modbus.RegisterParam, len(points))
+	for i, p := range points {
+		params[i] = p.Param()
+		params[i].Slave = dev.Slave
 	}
-	if v, err := h.readFloat(voltParam); err == nil {
-		sensorState := SensorState{
-			Ts:    now,
-			Cap:   "sensor.voltage",
-			Unit:  "V",
-			Value: round(v, 1),
-		}
-		err := h.publishEvent(cfg, sensorState, path)
+	readings := h.readBatch(params)
+	values := make([]float64, len(readings))
+
+	for i, p := range points {
+		polled[p.ID] = true
+		v, err := readings[i].Value, readings[i].Err
+		attrs := []any{"device_id", dev.DeviceID, "point", p.ID, "slave", dev.Slave, "addr", p.Addr, "cap", p.Cap}
 		if err != nil {
-			log.Printf("Error publishing sensor state: %v", err)
+			logPollError(dev.DeviceID+"/"+p.ID, "read failed", err, attrs...)
+			continue
 		}
-	}
-	// energy.meter (optional fields if mapped)
-	var pwPtr, ekPtr *float64
-	ok := false
-
-	if cfg.MapCfg.Power.Addr != 0 {
-		p := modbus.RegisterParam{
-			Addr:    cfg.MapCfg.Power.Addr,
-			Scale:   cfg.MapCfg.Power.Scale,
-			Holding: cfg.MapCfg.Power.Holding,
+		if pollErrors.Clear(dev.DeviceID + "/" + p.ID) {
+			slog.Info("read recovered", attrs...)
 		}
-		if v, err := h.readFloat(p); err == nil {
-			pw := round(v, 1)
-			pwPtr = pw
-			ok = true
-		} else {
-			log.Printf("read power: %v", err)
+		if !p.Function.IsBit() {
+			v = round(v, p.Precision)
 		}
-	}
-
-	if cfg.MapCfg.Energy.Addr != 0 {
-		p := modbus.RegisterParam{
-			Addr:    cfg.MapCfg.Energy.Addr,
-			Scale:   cfg.MapCfg.Energy.Scale,
-			Holding: cfg.MapCfg.Energy.Holding,
+		values[i] = v
+		h.activity.read()
+		metrics.PointValue.WithLabelValues(dev.DeviceID, p.ID, p.Cap).Set(v)
+		add(p, v)
+		if dev.report != nil {
+			dev.report.read(p, v)
 		}
-		if v, err := h.readFloat(p); err == nil {
-			ek := round(v, 6)
-			ekPtr = ek
-			ok = true
-		} else {
-			log.Printf("read energy: %v", err)
+		due[p.Cap] = due[p.Cap] || dev.report == nil || dev.report.due(p, v, at)
+	}
+	if dev.report != nil {
+		for _, p := range dev.Map.Points {
+			if byCap[p.Cap] == nil || polled[p.ID] {
+				continue
+			}
+			if v, ok := dev.report.lastRead(p); ok {
+				add(p, v)
+			}
 		}
 	}
 
-	if ok {
-		state := SensorState{
-			Ts:        now,
-			Cap:       "energy.meter",
-			PowerW:    pwPtr,
-			EnergyKwh: ekPtr,
+	for _, st := range states {
+		if !due[st.Cap] {
+			continue
 		}
-		if err := h.publishEvent(cfg, state, path); err != nil {
-			log.Printf("publish state: %v", err)
+		if dev.report != nil {
+			for i, p := range points {
+				if p.Cap == st.Cap && readings[i].Err == nil {
+					dev.report.published(p, values[i], at)
+				}
+			}
 		}
+		if dev.StateTopics != statePerCap {
+			publishState(h, dev, st, "/state", false)
+		}
+		if dev.StateTopics == statePerCap || dev.StateTopics == stateBoth {
+			// retained so HA shows the last value right after discovery
+			publishState(h, dev, st, "/"+st.Cap+"/state", true)
+		}
+	}
+}
+
+// publishState publishes st on smh/<device><path>.
+func publishState(h MainHandler, dev deviceCfg, st *SensorState, path string, retain bool) {
+	topic := "smh/" + dev.DeviceID + path
+	key := "publish " + topic
+	if err := h.publish(dev.DeviceID, st, path, retain); err != nil {
+		logPollError(key, "publish state failed", err, "device_id", dev.DeviceID, "cap", st.Cap, "topic", topic)
+		return
+	}
+	if pollErrors.Clear(key) {
+		slog.Info("publish state recovered", "device_id", dev.DeviceID, "cap", st.Cap, "topic", topic)
 	}
+	h.activity.published()
+	slog.Debug("state published", "device_id", dev.DeviceID, "cap", st.Cap, "topic", topic)
+}
 
+// logPollError logs err unless it is a repeat of the last error for key
+// within the pollErrors interval.
+func logPollError(key, msg string, err error, attrs ...any) {
+	ok, suppressed := pollErrors.Allow(key, err.Error(), time.Now())
+	if !ok {
+		return
+	}
+	attrs = append(attrs, "err", err)
+	if suppressed > 0 {
+		attrs = append(attrs, "suppressed", suppressed)
+	}
+	slog.Warn(msg, attrs...)
 }
@@ -1,164 +1,182 @@
 package main
 
-//import (
-//	"encoding/json"
-//	"os"
-//	"path/filepath"
-//	"testing"
-//)
-//
-//// mock handler returning fixed values derived from a JSON map
-//type mockHandler struct {
-//	values map[string]float64
-//}
-//
-//func (m *mockHandler) readFloat(addr uint16, scale float64, holding bool) (float64, error) {
-//	// key as "addr:<n>"
-//	key := "addr:" + itoa(int(addr))
-//	if v, ok := m.values[key]; ok {
-//		return v / scale, nil
-//	}
-//	// not found -> simulate read error by returning zero and no error;
-//	// PublishOnce treats missing metrics gracefully when addr==0
-//	return 0, nil
-//}
-//func (m *mockHandler) Close() error { return nil }
-//
-//// mock mqtt publisher collecting published JSON payloads
-//type mockMQTT struct{ msgs [][]byte }
-//
-//func (m *mockMQTT) Publish(topic string, payload []byte, qos byte, retain bool) error {
-//	m.msgs = append(m.msgs, payload)
-//	return nil
-//}
-//
-//func TestPublishOnce_WithMockHandler(t *testing.T) {
-//	// load golden and script values
-//	td := filepath.Join("testdata", "fixtures", "modbus")
-//	_ = os.MkdirAll(td, 0o755)
-//
-//	// script values emulate raw registers BEFORE scaling (frequency 5000->50.00Hz, voltage 2300->230.0V, power 800W, energy 12345/100=123.45kWh)
-//	script := map[string]float64{
-//		"addr:8192": 5000,  // 0x2000
-//		"addr:8193": 2300,  // 0x2001
-//		"addr:8195": 800,   // 0x2003
-//		"addr:8196": 12345, // 0x2004
-//	}
-//	h := &mockHandler{values: script}
-//	mq := &mockMQTT{}
-//
-//	cfg := loadEnv()
-//	// enforce deterministic device id and map
-//	cfg.DeviceID = "cw100.inverter"
-//	cfg.MapCfg.Frequency.Addr = 0x2000
-//	cfg.MapCfg.Frequency.Scale = 100
-//	cfg.MapCfg.Frequency.Holding = true
-//	cfg.MapCfg.Voltage.Addr = 0x2001
-//	cfg.MapCfg.Voltage.Scale = 10
-//	cfg.MapCfg.Voltage.Holding = true
-//	cfg.MapCfg.Power.Addr = 0x2003
-//	cfg.MapCfg.Power.Scale = 1
-//	cfg.MapCfg.Power.Holding = true
-//	cfg.MapCfg.Energy.Addr = 0x2004
-//	cfg.MapCfg.Energy.Scale = 100
-//	cfg.MapCfg.Energy.Holding = true
-//
-//	now := int64(1700000000)
-//	PublishOnce(h, cfg, now)
-//
-//	if len(mq.msgs) != 3 {
-//		t.Fatalf("expected 3 state messages, got %d", len(mq.msgs))
-//	}
-//
-//	// compare each payload against golden allowing numeric approx
-//	golden := []string{
-//		filepath.Join(td, "state_frequency.json"),
-//		filepath.Join(td, "state_voltage.json"),
-//		filepath.Join(td, "state_energy.json"),
-//	}
-//	gotObjs := make([]map[string]interface{}, 0, 3)
-//	for _, b := range mq.msgs {
-//		var m map[string]interface{}
-//		if err := json.Unmarshal(b, &m); err != nil {
-//			t.Fatalf("bad json: %v", err)
-//		}
-//		gotObjs = append(gotObjs, m)
-//	}
-//	// load goldens and check presence
-//	wantObjs := make([]map[string]interface{}, 0, 3)
-//	for _, g := range golden {
-//		b, err := os.ReadFile(g)
-//		if err != nil {
-//			t.Fatalf("missing golden %s: %v", g, err)
-//		}
-//		var m map[string]interface{}
-//		if err := json.Unmarshal(b, &m); err != nil {
-//			t.Fatalf("bad golden json: %v", err)
-//		}
-//		wantObjs = append(wantObjs, m)
-//	}
-//	for _, want := range wantObjs {
-//		found := false
-//		for _, got := range gotObjs {
-//			if approxEqualJSON(got, want, 1e-3) {
-//				found = true
-//				break
-//			}
-//		}
-//		if !found {
-//			t.Fatalf("expected to find payload like %v in published messages", stringMust(json.Marshal(want)))
-//		}
-//	}
-//}
-//
-//// helpers
-//func approxEqualJSON(got, want map[string]interface{}, eps float64) bool {
-//	for k, v := range want {
-//		gv, ok := got[k]
-//		if !ok {
-//			return false
-//		}
-//		switch w := v.(type) {
-//		case float64:
-//			gf, ok := gv.(float64)
-//			if !ok {
-//				return false
-//			}
-//			if abs(gf-w) > eps {
-//				return false
-//			}
-//		default:
-//			if stringMust(json.Marshal(gv)) != stringMust(json.Marshal(w)) {
-//				return false
-//			}
-//		}
-//	}
-//	return true
-//}
-//
-//func abs(x float64) float64 {
-//	if x < 0 {
-//		return -x
-//	}
-//	return x
-//}
-//func stringMust(b []byte, _ error) string { return string(b) }
-//func itoa(i int) string                   { return fmtInt(i) }
-//
-//// tiny fmt-free int->string to avoid extra imports in this snippet
-//func fmtInt(n int) string {
-//	if n == 0 {
-//		return "0"
-//	}
-//	sign := ""
-//	if n < 0 {
-//		sign = "-"
-//		n = -n
-//	}
-//	var d []byte
-//	for n > 0 {
-//		d = append([]byte{byte('0' + n%10)}, d...)
-//		n /= 10
-//	}
-//	return sign + string(d)
-//}
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	modbusMock "github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	mqttMock "github.com/tetragramaton/smh-go/internal/interface/mqtt/mock"
+	"github.com/tetragramaton/smh-go/internal/profile"
+)
+
+func TestPublishOnce_WithMockHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	td := filepath.Join("testdata", "fixtures", "modbus")
+
+	// script values emulate raw registers BEFORE scaling (frequency 5000->50.00Hz, voltage 2300->230.0V, power 800W, energy 12345/100=123.45kWh)
+	script := map[uint16]float64{
+		0x2000: 5000,
+		0x2001: 2300,
+		0x2003: 800,
+		0x2004: 12345,
+	}
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().ReadBatch(gomock.Any()).DoAndReturn(func(params []modbus.RegisterParam) []modbus.Reading {
+		readings := make([]modbus.Reading, len(params))
+		for i, p := range params {
+			if p.Slave != 1 {
+				t.Errorf("addr %#x: unexpected slave %d", p.Addr, p.Slave)
+			}
+			readings[i].Value = script[p.Addr] / p.Scale
+		}
+		return readings
+	})
+
+	var msgs [][]byte
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		if m.Topic != "smh/cw100.inverter/state" {
+			t.Errorf("unexpected topic %s", m.Topic)
+		}
+		msgs = append(msgs, m.Payload)
+		return nil
+	}).AnyTimes()
+
+	regMap, err := profile.Builtin("CW100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := deviceCfg{DeviceID: "cw100.inverter", Slave: 1, Map: regMap}
+	h := MainHandler{MQQTClient: mq, ModbusClient: mb}
+
+	now := int64(1700000000)
+	PublishOnce(h, dev, now)
+
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 state messages, got %d", len(msgs))
+	}
+
+	// compare each payload against golden allowing numeric approx
+	golden := []string{
+		filepath.Join(td, "state_frequency.json"),
+		filepath.Join(td, "state_voltage.json"),
+		filepath.Join(td, "state_energy.json"),
+	}
+	for i, g := range golden {
+		b, err := os.ReadFile(g)
+		if err != nil {
+			t.Fatalf("missing golden %s: %v", g, err)
+		}
+		var want, got map[string]interface{}
+		if err := json.Unmarshal(b, &want); err != nil {
+			t.Fatalf("bad golden json: %v", err)
+		}
+		if err := json.Unmarshal(msgs[i], &got); err != nil {
+			t.Fatalf("bad json: %v", err)
+		}
+		if !approxEqualJSON(got, want, 1e-3) {
+			t.Fatalf("payload %d: got %s, want %s", i, msgs[i], b)
+		}
+	}
+}
+
+// helpers
+func approxEqualJSON(got, want map[string]interface{}, eps float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for k, v := range want {
+		gv, ok := got[k]
+		if !ok {
+			return false
+		}
+		switch w := v.(type) {
+		case float64:
+			gf, ok := gv.(float64)
+			if !ok {
+				return false
+			}
+			if abs(gf-w) > eps {
+				return false
+			}
+		default:
+			if stringMust(json.Marshal(gv)) != stringMust(json.Marshal(w)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func stringMust(b []byte, _ error) string { return string(b) }
+
+func TestPublishOnce_PerCapTopics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().ReadBatch(gomock.Any()).DoAndReturn(func(params []modbus.RegisterParam) []modbus.Reading {
+		return make([]modbus.Reading, len(params))
+	})
+
+	retained := map[string]bool{}
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		retained[m.Topic] = m.Retain
+		return nil
+	}).AnyTimes()
+
+	regMap, err := profile.Builtin("CW100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := deviceCfg{DeviceID: "cw100.inverter", Slave: 1, Map: regMap, StateTopics: stateBoth}
+	PublishOnce(MainHandler{MQQTClient: mq, ModbusClient: mb}, dev, 1700000000)
+
+	want := map[string]bool{
+		"smh/cw100.inverter/state":                  false,
+		"smh/cw100.inverter/sensor.frequency/state": true,
+		"smh/cw100.inverter/sensor.voltage/state":   true,
+		"smh/cw100.inverter/energy.meter/state":     true,
+	}
+	if len(retained) != len(want) {
+		t.Fatalf("published %v, want %v", retained, want)
+	}
+	for topic, r := range want {
+		if got, ok := retained[topic]; !ok || got != r {
+			t.Errorf("%s: published %v retained %v, want retained %v", topic, ok, got, r)
+		}
+	}
+}
+
+func TestPublishOnce_BitsAreBooleans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mb := modbusMock.NewMockClient(ctrl)
+	mb.EXPECT().ReadBatch(gomock.Any()).Return([]modbus.Reading{{Value: 1}, {Value: 0}})
+
+	var st map[string]any
+	mq := mqttMock.NewMockClient(ctrl)
+	mq.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		return json.Unmarshal(m.Payload, &st)
+	})
+
+	dev := deviceCfg{DeviceID: "relay", Slave: 1, Map: modbus.RegMap{Points: []modbus.Point{
+		{ID: "ch1", Cap: "switch.relay", Field: "ch1", Addr: 0, Function: modbus.FuncCoil},
+		{ID: "ch2", Cap: "switch.relay", Field: "ch2", Addr: 1, Function: modbus.FuncCoil},
+	}}}
+	PublishOnce(MainHandler{MQQTClient: mq, ModbusClient: mb}, dev, 1700000000)
+
+	if st["ch1"] != true || st["ch2"] != false {
+		t.Fatalf("coils not published as booleans: %v", st)
+	}
+}
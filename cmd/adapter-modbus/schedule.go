@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+)
+
+// pollGroup is the points of a device read together at one interval and
+// phase.
+type pollGroup struct {
+	dev      deviceCfg
+	points   []modbus.Point
+	interval time.Duration
+	phase    time.Duration
+	next     time.Time
+	skipped  uint64 // cycles lost to overruns
+}
+
+// scheduler polls every group on its own wall-clock aligned slots:
+// now truncated to the interval plus the phase offset.
+type scheduler struct {
+	groups []*pollGroup
+}
+
+// newScheduler groups the points of devices by poll_ms and phase_ms; points
+// without poll_ms use def.
+func newScheduler(devices []deviceCfg, def time.Duration, start time.Time) *scheduler {
+	type key struct {
+		dev             int
+		interval, phase time.Duration
+	}
+	if def <= 0 {
+		def = time.Second
+	}
+	groups := map[key]*pollGroup{}
+	s := &scheduler{}
+	for i, dev := range devices {
+		for _, p := range dev.Map.Points {
+			k := key{dev: i, interval: def, phase: time.Duration(p.PhaseMs) * time.Millisecond}
+			if p.PollMs > 0 {
+				k.interval = time.Duration(p.PollMs) * time.Millisecond
+			}
+			g, ok := groups[k]
+			if !ok {
+				g = &pollGroup{dev: dev, interval: k.interval, phase: k.phase % k.interval}
+				g.next = start.Truncate(g.interval).Add(g.phase)
+				if g.next.Before(start) {
+					g.next = g.next.Add(g.interval)
+				}
+				groups[k] = g
+				s.groups = append(s.groups, g)
+			}
+			g.points = append(g.points, p)
+		}
+	}
+	return s
+}
+
+// run polls the due groups until ctx is cancelled. After each round
+// afterRound is called, e.g. to publish availability changes.
+func (s *scheduler) run(ctx context.Context, poll func(*pollGroup, time.Time), afterRound func()) {
+	if len(s.groups) == 0 {
+		<-ctx.Done()
+		return
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		// groups sharing a slot are polled in device order
+		sort.SliceStable(s.groups, func(i, j int) bool { return s.groups[i].next.Before(s.groups[j].next) })
+		timer.Reset(time.Until(s.groups[0].next))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		for _, g := range s.groups {
+			if ctx.Err() != nil {
+				return
+			}
+			if g.next.After(time.Now()) {
+				break
+			}
+			poll(g, g.next)
+			s.advance(g, time.Now())
+		}
+		afterRound()
+	}
+}
+
+// advance moves g to its next slot after now. Slots that already passed
+// while polling are skipped and reported rather than polled late.
+func (s *scheduler) advance(g *pollGroup, now time.Time) {
+	g.next = g.next.Add(g.interval)
+	if g.next.After(now) {
+		return
+	}
+	missed := uint64(now.Sub(g.next)/g.interval) + 1
+	g.next = g.next.Add(time.Duration(missed) * g.interval)
+	g.skipped += missed
+	metrics.PollSkipped.WithLabelValues(g.dev.DeviceID, g.interval.String()).Add(float64(missed))
+	slog.Warn("poll overran", "device_id", g.dev.DeviceID, "interval", g.interval, "phase", g.phase,
+		"skipped", missed, "skipped_total", g.skipped)
+}
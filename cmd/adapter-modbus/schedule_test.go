@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+func TestNewScheduler_GroupsByIntervalAndPhase(t *testing.T) {
+	dev := deviceCfg{DeviceID: "meter", Map: modbus.RegMap{Points: []modbus.Point{
+		{ID: "frequency", PollMs: 250},
+		{ID: "voltage"},
+		{ID: "power"},
+		{ID: "energy", PollMs: 60000, PhaseMs: 5000},
+	}}}
+	start := time.Date(2024, 1, 1, 12, 0, 30, 100e6, time.UTC)
+	s := newScheduler([]deviceCfg{dev}, time.Second, start)
+
+	want := []struct {
+		interval time.Duration
+		points   int
+		next     time.Time
+	}{
+		{250 * time.Millisecond, 1, time.Date(2024, 1, 1, 12, 0, 30, 250e6, time.UTC)},
+		{time.Second, 2, time.Date(2024, 1, 1, 12, 0, 31, 0, time.UTC)},
+		{time.Minute, 1, time.Date(2024, 1, 1, 12, 1, 5, 0, time.UTC)},
+	}
+	if len(s.groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(s.groups), len(want))
+	}
+	for i, w := range want {
+		g := s.groups[i]
+		if g.interval != w.interval || len(g.points) != w.points || !g.next.Equal(w.next) {
+			t.Errorf("group %d: %v with %d points next %v, want %v with %d points next %v",
+				i, g.interval, len(g.points), g.next, w.interval, w.points, w.next)
+		}
+	}
+}
+
+func TestScheduler_AdvanceSkipsOverrunCycles(t *testing.T) {
+	slot := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := &pollGroup{dev: deviceCfg{DeviceID: "meter"}, interval: time.Second, next: slot}
+	s := &scheduler{groups: []*pollGroup{g}}
+
+	s.advance(g, slot.Add(300*time.Millisecond))
+	if !g.next.Equal(slot.Add(time.Second)) || g.skipped != 0 {
+		t.Fatalf("on time: next %v skipped %d", g.next, g.skipped)
+	}
+
+	// the read took 2.5s: the slots at +2s and +3s are lost
+	s.advance(g, slot.Add(3500*time.Millisecond))
+	if !g.next.Equal(slot.Add(4*time.Second)) || g.skipped != 2 {
+		t.Fatalf("overrun: next %v skipped %d", g.next, g.skipped)
+	}
+}
@@ -14,6 +14,8 @@ import (
 type MainHandler struct {
 	MQQTClient   mqttIface.Client
 	ModbusClient modbusClient.Client
+
+	activity *activity // set by Handle, for health checks
 }
 
 func NewMainHandler(
@@ -33,6 +33,8 @@ func InitMainHandler() (*MainHandler, error) {
 type MainHandler struct {
 	MQQTClient   mqtt.Client
 	ModbusClient modbus.Client
+
+	activity *activity // set by Handle, for health checks
 }
 
 func NewMainHandler(mqttClient2 mqtt.Client,
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+	"github.com/tetragramaton/smh-go/internal/client/ha"
+)
+
+// componentFor picks the Home Assistant component of a point. The domain
+// of the capability ("switch.pump", "select.mode", ...) wins for writable
+// points; otherwise the point kind decides. Read-only points are always
+// sensors or binary sensors.
+func componentFor(p capability.PointMeta) string {
+	domain, _, _ := strings.Cut(p.Cap, ".")
+	switch {
+	case domain == ha.ComponentClimate:
+		return ha.ComponentClimate
+	case !p.Writable && p.Binary:
+		return ha.ComponentBinarySensor
+	case !p.Writable:
+		return ha.ComponentSensor
+	}
+	switch domain {
+	case ha.ComponentSwitch, ha.ComponentNumber, ha.ComponentSelect, ha.ComponentButton:
+		return domain
+	}
+	switch {
+	case len(p.Options) > 0:
+		return ha.ComponentSelect
+	case p.Binary:
+		return ha.ComponentSwitch
+	}
+	return ha.ComponentNumber
+}
+
+// pointConfig builds the per-point entity of p, or nil for sensors of
+// declared capabilities, which are published per capability, and climate
+// points, which are merged by climateConfig.
+func pointConfig(meta capability.Meta, unique string, device *ha.Device, p capability.PointMeta) ha.Config {
+	entity := ha.Entity{
+		Name:     fmt.Sprintf("%s %s", meta.DeviceID, p.ID),
+		UniqueID: unique + "_" + sanitize(p.ID),
+		Device:   device,
+	}
+	stateTopic := stateTopic(meta, p.Cap)
+	commandTopic := fmt.Sprintf("smh/%s/set/%s", meta.DeviceID, p.ID)
+	onOff := stateTemplate(meta, p.Cap, fmt.Sprintf("('ON' if value_json.%s else 'OFF')", p.Field))
+	value := stateTemplate(meta, p.Cap, "value_json."+p.Field)
+
+	switch componentFor(p) {
+	case ha.ComponentSensor:
+		if _, ok := capability.Lookup(p.Cap); ok {
+			return nil
+		}
+		precision := p.Precision
+		return &ha.SensorConfig{
+			Entity:             entity,
+			StateTopic:         stateTopic,
+			ValueTpl:           value,
+			UnitOfMeas:         p.Unit,
+			SuggestedPrecision: &precision,
+		}
+	case ha.ComponentBinarySensor:
+		return &ha.BinarySensorConfig{Entity: entity, StateTopic: stateTopic, ValueTpl: onOff}
+	case ha.ComponentSwitch:
+		return &ha.SwitchConfig{Entity: entity, StateTopic: stateTopic, ValueTpl: onOff, CommandTopic: commandTopic}
+	case ha.ComponentNumber:
+		return &ha.NumberConfig{
+			Entity:       entity,
+			StateTopic:   stateTopic,
+			ValueTpl:     value,
+			CommandTopic: commandTopic,
+			UnitOfMeas:   p.Unit,
+			Min:          p.Min,
+			Max:          p.Max,
+			Step:         step(p.Precision),
+			Mode:         "box",
+		}
+	case ha.ComponentSelect:
+		if len(p.Options) == 0 {
+			return nil
+		}
+		return &ha.SelectConfig{
+			Entity:       entity,
+			StateTopic:   stateTopic,
+			ValueTpl:     optionTemplate(meta, p),
+			CommandTopic: commandTopic,
+			CommandTpl:   indexTemplate(p.Options),
+			Options:      p.Options,
+		}
+	case ha.ComponentButton:
+		// the adapter writes 1 to the point on every press
+		return &ha.ButtonConfig{Entity: entity, CommandTopic: commandTopic, PayloadPress: "1"}
+	}
+	return nil
+}
+
+// climateConfig builds a thermostat from the points of a climate.* cap:
+// "current" is the measured temperature, "target" the writable setpoint and
+// the optional "mode" an enumerated point whose options are HVAC modes.
+func climateConfig(meta capability.Meta, unique string, device *ha.Device, c string) ha.Config {
+	if !strings.HasPrefix(c, ha.ComponentClimate+".") {
+		return nil
+	}
+	cfg := &ha.ClimateConfig{
+		Entity: ha.Entity{
+			Name:     fmt.Sprintf("%s %s", meta.DeviceID, strings.TrimPrefix(c, ha.ComponentClimate+".")),
+			UniqueID: unique + "_" + sanitize(c),
+			Device:   device,
+		},
+	}
+	stateTopic := stateTopic(meta, c)
+	found := false
+	for _, p := range meta.Points {
+		if p.Cap != c {
+			continue
+		}
+		value := stateTemplate(meta, p.Cap, "value_json."+p.Field)
+		commandTopic := fmt.Sprintf("smh/%s/set/%s", meta.DeviceID, p.ID)
+		switch p.Field {
+		case "current":
+			cfg.CurrentTempTopic, cfg.CurrentTempTpl = stateTopic, value
+		case "target":
+			cfg.TempStateTopic, cfg.TempStateTpl = stateTopic, value
+			if p.Writable {
+				cfg.TempCommandTopic = commandTopic
+			}
+			cfg.MinTemp, cfg.MaxTemp = p.Min, p.Max
+			cfg.TempStep = step(p.Precision)
+			cfg.Precision = 1 // HA only accepts 0.1, 0.5 and 1
+			if p.Precision > 0 {
+				cfg.Precision = 0.1
+			}
+			if p.Unit == "°F" || p.Unit == "F" {
+				cfg.TempUnit = "F"
+			} else {
+				cfg.TempUnit = "C"
+			}
+			found = true
+		case "mode":
+			cfg.Modes = p.Options
+			cfg.ModeStateTopic, cfg.ModeStateTpl = stateTopic, optionTemplate(meta, p)
+			if p.Writable {
+				cfg.ModeCommandTopic = commandTopic
+				cfg.ModeCommandTpl = indexTemplate(p.Options)
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return cfg
+}
+
+// stateTopic returns the topic the state of cap c is read from: its own
+// retained topic when the adapter publishes one, the combined one otherwise.
+func stateTopic(meta capability.Meta, c string) string {
+	if meta.PerCapState {
+		return fmt.Sprintf("smh/%s/%s/state", meta.DeviceID, c)
+	}
+	return fmt.Sprintf("smh/%s/state", meta.DeviceID)
+}
+
+// stateTemplate renders expr for cap c. On the combined topic the other
+// caps' messages must render nothing.
+func stateTemplate(meta capability.Meta, c, expr string) string {
+	if meta.PerCapState {
+		return "{{ " + expr + " }}"
+	}
+	return capability.Template(c, expr)
+}
+
+// step returns the smallest increment shown with precision decimals.
+func step(precision int) float64 {
+	return math.Pow10(-precision)
+}
+
+// optionTemplate renders the label of an enumerated point value.
+func optionTemplate(meta capability.Meta, p capability.PointMeta) string {
+	return stateTemplate(meta, p.Cap, fmt.Sprintf("%s[value_json.%s | int]", jinjaList(p.Options), p.Field))
+}
+
+// indexTemplate turns a selected label back into the raw value to write.
+func indexTemplate(options []string) string {
+	return fmt.Sprintf("{{ %s.index(value) }}", jinjaList(options))
+}
+
+// jinjaList renders options as a list literal; JSON is valid Jinja here.
+func jinjaList(options []string) string {
+	b, _ := json.Marshal(options)
+	return string(b)
+}
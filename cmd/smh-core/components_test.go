@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+	"github.com/tetragramaton/smh-go/internal/client/ha"
+)
+
+func TestComponentFor(t *testing.T) {
+	cases := []struct {
+		p    capability.PointMeta
+		want string
+	}{
+		{capability.PointMeta{Cap: "sensor.voltage"}, ha.ComponentSensor},
+		{capability.PointMeta{Cap: "switch.pump"}, ha.ComponentSensor},
+		{capability.PointMeta{Cap: "relay", Binary: true}, ha.ComponentBinarySensor},
+		{capability.PointMeta{Cap: "relay", Binary: true, Writable: true}, ha.ComponentSwitch},
+		{capability.PointMeta{Cap: "switch.pump", Writable: true}, ha.ComponentSwitch},
+		{capability.PointMeta{Cap: "setpoint", Writable: true}, ha.ComponentNumber},
+		{capability.PointMeta{Cap: "fan", Writable: true, Options: []string{"low", "high"}}, ha.ComponentSelect},
+		{capability.PointMeta{Cap: "button.reset", Writable: true}, ha.ComponentButton},
+		{capability.PointMeta{Cap: "climate.room", Field: "current"}, ha.ComponentClimate},
+	}
+	for _, c := range cases {
+		if got := componentFor(c.p); got != c.want {
+			t.Errorf("%+v: got %s, want %s", c.p, got, c.want)
+		}
+	}
+}
+
+func TestDiscoveryConfigs_Climate(t *testing.T) {
+	lo, hi := 5.0, 30.0
+	meta := capability.Meta{
+		DeviceID: "hvac",
+		Caps:     []string{"climate.room"},
+		Points: []capability.PointMeta{
+			{ID: "room_temp", Cap: "climate.room", Field: "current", Unit: "°C", Precision: 1},
+			{ID: "setpoint", Cap: "climate.room", Field: "target", Unit: "°C", Precision: 1, Writable: true, Min: &lo, Max: &hi},
+			{ID: "hvac_mode", Cap: "climate.room", Field: "mode", Writable: true, Options: []string{"off", "heat"}},
+		},
+	}
+	entries := discoveryConfigs(meta)
+	if len(entries) != 1 || entries[0].topic != "homeassistant/climate/hvac/climate_room/config" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	b, err := entries[0].cfg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"temperature_command_topic": "smh/hvac/set/setpoint",
+		"mode_command_topic":        "smh/hvac/set/hvac_mode",
+		"mode_command_template":     `{{ ["off","heat"].index(value) }}`,
+		"min_temp":                  5.0,
+		"max_temp":                  30.0,
+		"temp_step":                 0.1,
+		"temperature_unit":          "C",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestDiscoveryConfigs_PerCapState(t *testing.T) {
+	meta := capability.Meta{DeviceID: "sdm", Caps: []string{"sensor.voltage"}, PerCapState: true}
+	entries := discoveryConfigs(meta)
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	cfg := entries[0].cfg.(*ha.SensorConfig)
+	if cfg.StateTopic != "smh/sdm/sensor.voltage/state" || cfg.ValueTpl != "{{ value_json.value }}" {
+		t.Fatalf("state topic %q, template %q", cfg.StateTopic, cfg.ValueTpl)
+	}
+}
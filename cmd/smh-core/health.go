@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tetragramaton/smh-go/internal/health"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+)
+
+// serveHTTP exposes /metrics, /healthz and /readyz on addr. Core only
+// depends on the broker, so both report the MQTT connection.
+func (h *MainHandler) serveHTTP(ctx context.Context, addr string) {
+	check := health.Handler(h.health)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", check)
+	mux.Handle("/readyz", check)
+	health.Serve(ctx, addr, mux)
+}
+
+func (h *MainHandler) health() *health.Report {
+	r := health.NewReport()
+	r.Add("mqtt_connected", h.MQQTClient.IsConnectionOpen(), "")
+	return r
+}
@@ -1,32 +1,41 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	mq "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tetragramaton/smh-go/internal/capability"
 	"github.com/tetragramaton/smh-go/internal/client/ha"
+	"github.com/tetragramaton/smh-go/internal/health"
 	"github.com/tetragramaton/smh-go/internal/interface/mqtt"
-	"log"
+	"github.com/tetragramaton/smh-go/internal/logging"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+	"log/slog"
+	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 )
 
-type Meta struct {
-	DeviceID string   `json:"device_id"`
-	Model    string   `json:"model,omitempty"`
-	Area     string   `json:"area,omitempty"`
-	Caps     []string `json:"caps"`
-}
-
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := logging.Setup(); err != nil {
+		logging.Fatal("config", "err", err)
+	}
 	handler, err := InitMainHandler()
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("init", "err", err)
 	}
-	handler.Handle()
+	handler.Handle(ctx)
 }
 
-func (h *MainHandler) Handle() {
+// Handle serves meta announcements until ctx is cancelled.
+func (h *MainHandler) Handle(ctx context.Context) {
 	//broker := getenv("MQTT_URL", "tcp://mqtt:1883")
 	//clientID := getenv("CLIENT_ID", "smh-core-"+time.Now().Format("150405"))
 	//mc, err := mqtt.New(mqtt.Config{BrokerURL: broker, ClientID: clientID})
@@ -38,23 +47,217 @@ func (h *MainHandler) Handle() {
 		Topic: "smh/+/meta",
 		QoS:   1,
 		Callback: func(_ mq.Client, m mq.Message) {
-			var meta Meta
+			metrics.CoreMessages.WithLabelValues("meta").Inc()
+			if ctx.Err() != nil || len(m.Payload()) == 0 {
+				// shutting down, or a cleared retained meta
+				return
+			}
+			id := topicDevice(m.Topic())
+			var meta capability.Meta
+			var errs []FieldError
 			if err := json.Unmarshal(m.Payload(), &meta); err != nil {
-				log.Printf("bad meta: %v", err)
+				errs = []FieldError{{Message: "invalid JSON: " + err.Error()}}
+			} else {
+				errs = validateMeta(id, meta)
+			}
+			if len(errs) > 0 {
+				// quarantined: the previous meta and discovery stay in place
+				slog.Warn("rejected meta", "device_id", id, "errors", len(errs),
+					"field", errs[0].Field, "message", errs[0].Message)
+				h.publishMetaError(id, errs)
 				return
 			}
+			clearRetained(h, "smh/"+id+"/meta/error")
+			if err := h.Registry.Put(meta); err != nil {
+				slog.Error("registry put", "device_id", id, "err", err)
+			}
+			h.watchAvailability(availabilityTopics(meta)...)
 			publishDiscovery(h, meta)
 		},
 	}
 	err := h.MQQTClient.SubscribeToTopic(subscription)
 	if err != nil {
-		log.Fatalf("subscribe: %v", err)
+		logging.Fatal("subscribe", "topic", subscription.Topic, "err", err)
+	}
+
+	// liveness for the registry
+	h.watchAvailability(h.Registry.AvailabilityTopics()...)
+	var seen []mqtt.Subscription
+	stateErrors := logging.NewLimiter(stateErrorInterval)
+	for _, topic := range []string{"smh/+/state", "smh/+/+/state"} {
+		seen = append(seen, mqtt.Subscription{
+			Topic: topic,
+			QoS:   0,
+			Callback: func(_ mq.Client, m mq.Message) {
+				metrics.CoreMessages.WithLabelValues("state").Inc()
+				id := topicDevice(m.Topic())
+				rec, ok := h.Registry.Get(id)
+				if !ok || len(m.Payload()) == 0 {
+					return
+				}
+				if err := validateState(m.Topic(), m.Payload(), rec.Meta); err != nil {
+					// the same error is reported at most once per interval
+					if ok, n := stateErrors.Allow(m.Topic(), err.Error(), time.Now()); ok {
+						slog.Warn("invalid state", "device_id", id, "topic", m.Topic(), "err", err, "suppressed", n)
+					}
+					return
+				}
+				stateErrors.Clear(m.Topic())
+				if err := h.Registry.Touch(id); err != nil {
+					slog.Error("registry touch", "device_id", id, "err", err)
+				}
+			},
+		})
+	}
+	for _, sub := range seen {
+		if err := h.MQQTClient.SubscribeToTopic(sub); err != nil {
+			logging.Fatal("subscribe", "topic", sub.Topic, "err", err)
+		}
+	}
+
+	// explicit decommissioning; retained commands are ignored so a stale
+	// one cannot retire a device again after it is re-added
+	retire := mqtt.Subscription{
+		Topic: "smh/+/retire",
+		QoS:   1,
+		Callback: func(_ mq.Client, m mq.Message) {
+			metrics.CoreMessages.WithLabelValues("retire").Inc()
+			if ctx.Err() != nil || m.Retained() {
+				return
+			}
+			h.retire(topicDevice(m.Topic()))
+		},
+	}
+	if err := h.MQQTClient.SubscribeToTopic(retire); err != nil {
+		logging.Fatal("subscribe", "topic", retire.Topic, "err", err)
+	}
+
+	// Home Assistant announces itself after a restart and expects discovery again
+	birth := mqtt.Subscription{
+		Topic: getenv("HA_STATUS_TOPIC", "homeassistant/status"),
+		QoS:   1,
+		Callback: func(_ mq.Client, m mq.Message) {
+			metrics.CoreMessages.WithLabelValues("ha_status").Inc()
+			if ctx.Err() != nil {
+				return
+			}
+			h.handleHAStatus(m.Payload())
+		},
+	}
+	if err := h.MQQTClient.SubscribeToTopic(birth); err != nil {
+		logging.Fatal("subscribe", "topic", birth.Topic, "err", err)
+	}
+	h.serveHTTP(ctx, health.Addr())
+	slog.Info("smh-core up; waiting for meta")
+	<-ctx.Done()
+
+	slog.Info("shutting down")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := h.MQQTClient.Close(250); err != nil {
+			slog.Error("mqtt client close", "err", err)
+		}
+		if err := h.Registry.Close(); err != nil {
+			slog.Error("registry close", "err", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		slog.Warn("shutdown timed out", "timeout", shutdownTimeout)
+	}
+}
+
+const shutdownTimeout = 5 * time.Second
+
+// stateErrorInterval limits how often the same invalid state error of a
+// topic is logged.
+const stateErrorInterval = time.Minute
+
+// watchAvailability subscribes the registry to online/offline topics of
+// devices: the adapter availability and its status topic, which the broker
+// sets offline through the Last Will when the adapter dies.
+func (h *MainHandler) watchAvailability(topics ...string) {
+	for _, t := range topics {
+		h.watchMu.Lock()
+		if h.watched == nil {
+			h.watched = map[string]bool{}
+		}
+		watched := h.watched[t]
+		h.watched[t] = true
+		h.watchMu.Unlock()
+		if watched {
+			continue
+		}
+		err := h.MQQTClient.SubscribeToTopic(mqtt.Subscription{
+			Topic: t,
+			QoS:   1,
+			Callback: func(_ mq.Client, m mq.Message) {
+				metrics.CoreMessages.WithLabelValues("availability").Inc()
+				if err := h.Registry.SetAvailability(m.Topic(), string(m.Payload())); err != nil {
+					slog.Error("registry set availability", "topic", m.Topic(), "err", err)
+				}
+			},
+		})
+		if err != nil {
+			slog.Error("subscribe", "topic", t, "err", err)
+			h.watchMu.Lock()
+			delete(h.watched, t)
+			h.watchMu.Unlock()
+		}
+	}
+}
+
+// handleHAStatus rediscovers when Home Assistant reports online; other
+// payloads such as its offline Last Will are ignored.
+func (h *MainHandler) handleHAStatus(payload []byte) {
+	if string(payload) == "online" {
+		h.rediscover()
+	}
+}
+
+// rediscover republishes discovery for every known device and asks the
+// adapters to re-send their current state on smh/<device>/request.
+func (h *MainHandler) rediscover() {
+	devices := h.Registry.All()
+	slog.Info("Home Assistant online; republishing discovery", "devices", len(devices))
+	for _, meta := range devices {
+		publishDiscovery(h, meta)
+		if err := h.MQQTClient.PublishEvent(mqtt.Message{
+			Topic:   "smh/" + meta.DeviceID + "/request",
+			Payload: []byte("state"),
+			QoS:     1,
+		}); err != nil {
+			slog.Error("publish state request", "device_id", meta.DeviceID, "err", err)
+		}
 	}
-	log.Println("smh-core up; waiting for meta...")
-	select {}
 }
 
-func publishDiscovery(mc *MainHandler, meta Meta) {
+// topicDevice returns the device ID of an smh/<device>/... topic.
+func topicDevice(topic string) string {
+	parts := strings.SplitN(topic, "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
+
+// discoveryEntry is one retained Home Assistant config message.
+type discoveryEntry struct {
+	topic string
+	cfg   ha.Config
+}
+
+// discoveryConfigs builds the Home Assistant entities of a device.
+func discoveryConfigs(meta capability.Meta) []discoveryEntry {
 	unique := sanitize(meta.DeviceID)
 	device := &ha.Device{
 		Identifiers:  []string{meta.DeviceID},
@@ -62,62 +265,127 @@ func publishDiscovery(mc *MainHandler, meta Meta) {
 		Model:        meta.Model,
 		Name:         meta.DeviceID,
 	}
+	var avail []map[string]string
+	for _, t := range meta.Availability {
+		avail = append(avail, map[string]string{"topic": t})
+	}
+	var entries []discoveryEntry
+	pubCfg := func(topic string, cfg ha.Config) {
+		cfg.Base().Availability = avail
+		if len(avail) > 1 {
+			cfg.Base().AvailabilityMode = "all"
+		}
+		entries = append(entries, discoveryEntry{topic: topic, cfg: cfg})
+	}
+
+	// capability fields the device announced points for; metas without
+	// points get every declared field
+	points := map[string]capability.PointMeta{}
+	for _, p := range meta.Points {
+		points[p.Cap+"/"+p.Field] = p
+	}
 
 	for _, c := range meta.Caps {
-		const stateFormat = "smh/%s/state"
-		switch c {
-		case "energy.meter":
-			cfgP := &ha.SensorConfig{
-				Name:        fmt.Sprintf("%s power", meta.DeviceID),
-				UniqueID:    unique + "_power",
-				StateTopic:  fmt.Sprintf(stateFormat, meta.DeviceID),
-				ValueTpl:    "{{ value_json.power_w if value_json.c == \"energy.meter\" }}",
-				DeviceClass: "power",
-				UnitOfMeas:  "W",
-				Device:      device,
-			}
-			pubCfg(mc, ha.TopicSensorConfig("power_w", unique), cfgP)
-			cfgE := &ha.SensorConfig{
-				Name:        fmt.Sprintf("%s energy", meta.DeviceID),
-				UniqueID:    unique + "_energy",
-				StateTopic:  fmt.Sprintf(stateFormat, meta.DeviceID),
-				ValueTpl:    "{{ value_json.energy_kwh if value_json.c == \"energy.meter\" }}",
-				DeviceClass: "energy",
-				UnitOfMeas:  "kWh",
-				Device:      device,
+		capDef, ok := capability.Lookup(c)
+		if !ok {
+			continue
+		}
+		for _, f := range capDef.Fields {
+			p, ok := points[c+"/"+f.Name]
+			if !ok && len(meta.Points) > 0 {
+				continue
 			}
-			pubCfg(mc, ha.TopicSensorConfig("energy_kwh", unique), cfgE)
-
-		case "sensor.frequency":
 			cfg := &ha.SensorConfig{
-				Name:       fmt.Sprintf("%s frequency", meta.DeviceID),
-				UniqueID:   unique + "_freq",
-				StateTopic: fmt.Sprintf(stateFormat, meta.DeviceID),
-				ValueTpl:   "{{ value_json.value if value_json.c == \"sensor.frequency\" }}",
-				UnitOfMeas: "Hz",
-				Device:     device,
+				Entity: ha.Entity{
+					Name:     fmt.Sprintf("%s %s", meta.DeviceID, f.Label),
+					UniqueID: unique + f.UniqueSuffix,
+					Device:   device,
+				},
+				StateTopic:  stateTopic(meta, c),
+				ValueTpl:    stateTemplate(meta, c, "value_json."+f.Name),
+				DeviceClass: f.DeviceClass,
+				UnitOfMeas:  f.Unit,
+				StateClass:  f.StateClass,
 			}
-			pubCfg(mc, ha.TopicSensorConfig("frequency", unique), cfg)
-
-		case "sensor.voltage":
-			cfg := &ha.SensorConfig{
-				Name:       fmt.Sprintf("%s voltage", meta.DeviceID),
-				UniqueID:   unique + "_volt",
-				StateTopic: fmt.Sprintf(stateFormat, meta.DeviceID),
-				ValueTpl:   "{{ value_json.value if value_json.c == \"sensor.voltage\" }}",
-				UnitOfMeas: "V",
-				Device:     device,
+			if ok {
+				cfg.SuggestedPrecision = &p.Precision
 			}
-			pubCfg(mc, ha.TopicSensorConfig("voltage", unique), cfg)
+			pubCfg(ha.TopicSensorConfig(f.Object, unique), cfg)
+		}
+	}
+
+	// per-point entities; controllable points become switches, numbers,
+	// selects or buttons, climate caps a single thermostat
+	for _, p := range meta.Points {
+		if cfg := pointConfig(meta, unique, device, p); cfg != nil {
+			pubCfg(ha.Topic(cfg, sanitize(p.ID), unique), cfg)
+		}
+	}
+	for _, c := range meta.Caps {
+		if cfg := climateConfig(meta, unique, device, c); cfg != nil {
+			pubCfg(ha.Topic(cfg, sanitize(c), unique), cfg)
 		}
 	}
-	log.Printf("HA discovery published for %s (%v)", meta.DeviceID, meta.Caps)
+	return entries
+}
+
+// publishDiscovery publishes the device entities and deletes the ones it
+// published before that are no longer part of the meta.
+func publishDiscovery(mc *MainHandler, meta capability.Meta) {
+	entries := discoveryConfigs(meta)
+	topics := make([]string, len(entries))
+	for i, e := range entries {
+		publishConfig(mc, e.topic, e.cfg)
+		metrics.DiscoveryPublished.WithLabelValues(e.cfg.Component()).Inc()
+		topics[i] = e.topic
+	}
+	obsolete, err := mc.Registry.SetDiscovery(meta.DeviceID, topics)
+	if err != nil {
+		slog.Error("registry set discovery", "device_id", meta.DeviceID, "err", err)
+	}
+	for _, t := range obsolete {
+		clearRetained(mc, t)
+	}
+	slog.Info("HA discovery published", "device_id", meta.DeviceID, "caps", meta.Caps,
+		"entities", len(topics), "removed", len(obsolete))
 }
 
-func pubCfg(mc *MainHandler, topic string, cfg *ha.SensorConfig) {
+// retire purges every discovery topic of a device together with its retained
+// meta and availability, and forgets it.
+func (h *MainHandler) retire(deviceID string) {
+	rec, ok, err := h.Registry.Remove(deviceID)
+	if err != nil {
+		slog.Error("registry remove", "device_id", deviceID, "err", err)
+	}
+	if !ok {
+		slog.Warn("retire unknown device", "device_id", deviceID)
+		return
+	}
+	topics := map[string]bool{}
+	for _, t := range rec.Discovery {
+		topics[t] = true
+	}
+	// records written before discovery topics were tracked
+	for _, e := range discoveryConfigs(rec.Meta) {
+		topics[e.topic] = true
+	}
+	for t := range topics {
+		clearRetained(h, t)
+	}
+	if rec.Meta.PerCapState {
+		for _, c := range rec.Meta.Caps {
+			clearRetained(h, stateTopic(rec.Meta, c))
+		}
+	}
+	clearRetained(h, "smh/"+deviceID+"/meta")
+	clearRetained(h, "smh/"+deviceID+"/availability")
+	slog.Info("device retired", "device_id", deviceID, "removed", len(topics))
+}
+
+func publishConfig(mc *MainHandler, topic string, cfg ha.Config) {
 	b, err := cfg.Marshal()
 	if err != nil {
-		log.Printf("marshal cfg: %v", err)
+		slog.Error("marshal discovery config", "topic", topic, "err", err)
 		return
 	}
 	if err := mc.MQQTClient.PublishEvent(mqtt.Message{
@@ -126,7 +394,18 @@ func pubCfg(mc *MainHandler, topic string, cfg *ha.SensorConfig) {
 		QoS:     1,
 		Retain:  true,
 	}); err != nil {
-		log.Printf("publish cfg: %v", err)
+		slog.Error("publish discovery config", "topic", topic, "err", err)
+	}
+}
+
+// clearRetained deletes a retained message by publishing an empty payload.
+func clearRetained(mc *MainHandler, topic string) {
+	if err := mc.MQQTClient.PublishEvent(mqtt.Message{
+		Topic:  topic,
+		QoS:    1,
+		Retain: true,
+	}); err != nil {
+		slog.Error("clear retained", "topic", topic, "err", err)
 	}
 }
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	mq "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/mock/gomock"
+	"github.com/tetragramaton/smh-go/internal/capability"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	mqttMock "github.com/tetragramaton/smh-go/internal/interface/mqtt/mock"
+)
+
+func TestPublishDiscovery_RemovesDroppedCaps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	registry, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cleared []string
+	mc := mqttMock.NewMockClient(ctrl)
+	mc.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		if !m.Retain {
+			t.Errorf("%s: discovery must be retained", m.Topic)
+		}
+		if len(m.Payload) == 0 {
+			cleared = append(cleared, m.Topic)
+		}
+		return nil
+	}).AnyTimes()
+	h := &MainHandler{MQQTClient: mc, Registry: registry}
+
+	meta := capability.Meta{DeviceID: "sdm.1", Caps: []string{"sensor.voltage", "sensor.frequency"}}
+	if err := registry.Put(meta); err != nil {
+		t.Fatal(err)
+	}
+	publishDiscovery(h, meta)
+	if len(cleared) != 0 {
+		t.Fatalf("nothing to remove on first announce, cleared %v", cleared)
+	}
+
+	meta.Caps = []string{"sensor.voltage"}
+	if err := registry.Put(meta); err != nil {
+		t.Fatal(err)
+	}
+	publishDiscovery(h, meta)
+	if want := "homeassistant/sensor/sdm_1/frequency/config"; len(cleared) != 1 || cleared[0] != want {
+		t.Fatalf("cleared %v, want [%s]", cleared, want)
+	}
+
+	cleared = nil
+	h.retire("sdm.1")
+	sort.Strings(cleared)
+	want := []string{
+		"homeassistant/sensor/sdm_1/voltage/config",
+		"smh/sdm.1/availability",
+		"smh/sdm.1/meta",
+	}
+	if len(cleared) != len(want) {
+		t.Fatalf("cleared %v, want %v", cleared, want)
+	}
+	for i := range want {
+		if cleared[i] != want[i] {
+			t.Fatalf("cleared %v, want %v", cleared, want)
+		}
+	}
+}
+
+func TestDiscoveryConfigs_EnergyDashboard(t *testing.T) {
+	meta := capability.Meta{
+		DeviceID: "cw100.inverter",
+		Caps:     []string{"energy.meter"},
+		Points: []capability.PointMeta{
+			{ID: "power", Cap: "energy.meter", Field: "power_w", Precision: 1},
+			{ID: "energy", Cap: "energy.meter", Field: "energy_kwh", Precision: 3},
+		},
+	}
+	want := map[string]string{
+		"homeassistant/sensor/cw100_inverter/power_w/config":    `"state_class":"measurement","suggested_display_precision":1`,
+		"homeassistant/sensor/cw100_inverter/energy_kwh/config": `"state_class":"total_increasing","suggested_display_precision":3`,
+	}
+	entries := discoveryConfigs(meta)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entities, want %d", len(entries), len(want))
+	}
+	for _, e := range entries {
+		b, err := e.cfg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want[e.topic]) {
+			t.Errorf("%s: %s does not contain %s", e.topic, b, want[e.topic])
+		}
+		// the adapter tags state payloads with "cap"
+		if !strings.Contains(string(b), `value_json.cap == \"energy.meter\"`) {
+			t.Errorf("%s: template does not match the state payload: %s", e.topic, b)
+		}
+	}
+}
+
+func TestHandleHAStatus_RediscoversOnline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	registry, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, meta := range []capability.Meta{
+		{DeviceID: "sdm.1", Caps: []string{"sensor.voltage"}},
+		{DeviceID: "sdm.2", Caps: []string{"sensor.frequency"}},
+	} {
+		if err := registry.Put(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published := map[string]string{}
+	mc := mqttMock.NewMockClient(ctrl)
+	h := &MainHandler{MQQTClient: mc, Registry: registry}
+
+	// no publish expected: gomock fails on any call
+	for _, payload := range []string{"offline", "", "ONLINE"} {
+		h.handleHAStatus([]byte(payload))
+	}
+
+	mc.EXPECT().PublishEvent(gomock.Any()).DoAndReturn(func(m mqttIface.Message) error {
+		published[m.Topic] = string(m.Payload)
+		return nil
+	}).AnyTimes()
+	h.handleHAStatus([]byte("online"))
+
+	for _, topic := range []string{
+		"homeassistant/sensor/sdm_1/voltage/config",
+		"homeassistant/sensor/sdm_2/frequency/config",
+	} {
+		if published[topic] == "" {
+			t.Errorf("%s not republished", topic)
+		}
+	}
+	for _, dev := range []string{"sdm.1", "sdm.2"} {
+		if got := published["smh/"+dev+"/request"]; got != "state" {
+			t.Errorf("%s: state request %q", dev, got)
+		}
+	}
+}
+
+// message is an incoming MQTT message for subscription callbacks.
+type message struct {
+	mq.Message
+	topic   string
+	payload []byte
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return m.payload }
+
+func TestWatchAvailability_StatusTopicLastWill(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	registry, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := capability.Meta{DeviceID: "cw100.inverter", Availability: []string{"smh/cw100.inverter/availability", "smh/adapter/status"}}
+	if err := registry.Put(meta); err != nil {
+		t.Fatal(err)
+	}
+
+	subs := map[string]mqttIface.Subscription{}
+	mc := mqttMock.NewMockClient(ctrl)
+	mc.EXPECT().SubscribeToTopic(gomock.Any()).DoAndReturn(func(s mqttIface.Subscription) error {
+		subs[s.Topic] = s
+		return nil
+	}).Times(2)
+	h := &MainHandler{MQQTClient: mc, Registry: registry}
+
+	h.watchAvailability(registry.AvailabilityTopics()...)
+	// a re-announced meta does not subscribe again
+	h.watchAvailability(availabilityTopics(meta)...)
+
+	deliver := func(topic, payload string) {
+		s, ok := subs[topic]
+		if !ok {
+			t.Fatalf("%s not subscribed", topic)
+		}
+		s.Callback(nil, message{topic: topic, payload: []byte(payload)})
+	}
+	deliver("smh/cw100.inverter/availability", "online")
+	deliver("smh/adapter/status", "online")
+	if rec, _ := registry.Get("cw100.inverter"); rec.Availability != "online" {
+		t.Fatalf("availability %q, want online", rec.Availability)
+	}
+	deliver("smh/adapter/status", "offline")
+	if rec, _ := registry.Get("cw100.inverter"); rec.Availability != "offline" {
+		t.Fatalf("availability %q after the Last Will, want offline", rec.Availability)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+)
+
+// touchSaveInterval limits how often state traffic alone rewrites the file.
+const touchSaveInterval = time.Minute
+
+// DeviceRecord is what core remembers about a device.
+type DeviceRecord struct {
+	Meta         capability.Meta `json:"meta"`
+	FirstSeen    time.Time       `json:"first_seen"`
+	LastSeen     time.Time       `json:"last_seen"`
+	Availability string          `json:"availability,omitempty"` // online, offline or unknown if empty
+	// AvailabilityTopics holds the last payload of each availability topic
+	// of the meta; the device is online only if all of them are.
+	AvailabilityTopics map[string]string `json:"availability_topics,omitempty"`
+	// Discovery holds the retained Home Assistant config topics last
+	// published for the device.
+	Discovery []string `json:"discovery,omitempty"`
+}
+
+// DeviceRegistry keeps the last meta announced by every device so discovery
+// can be rebuilt without waiting for adapters to re-announce. It is backed
+// by a JSON file and survives restarts.
+type DeviceRegistry struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]*DeviceRecord
+	dirty   bool
+	savedAt time.Time
+}
+
+// OpenDeviceRegistry loads the registry from path; a missing file yields an
+// empty registry that is created on the first change.
+func OpenDeviceRegistry(path string) (*DeviceRegistry, error) {
+	r := &DeviceRegistry{path: path, devices: map[string]*DeviceRecord{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*DeviceRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("registry %s: %w", path, err)
+	}
+	for _, rec := range records {
+		r.devices[rec.Meta.DeviceID] = rec
+	}
+	return r, nil
+}
+
+// Put stores meta as the latest announcement of its device.
+func (r *DeviceRegistry) Put(meta capability.Meta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	rec, ok := r.devices[meta.DeviceID]
+	if !ok {
+		rec = &DeviceRecord{FirstSeen: now}
+		r.devices[meta.DeviceID] = rec
+	}
+	rec.Meta = meta
+	rec.LastSeen = now
+	// forget topics the device no longer lists
+	for t := range rec.AvailabilityTopics {
+		if !slices.Contains(availabilityTopics(meta), t) {
+			delete(rec.AvailabilityTopics, t)
+		}
+	}
+	rec.Availability = rec.availability()
+	return r.save()
+}
+
+// SetAvailability records an online/offline payload on topic for every
+// known device listing it, e.g. the adapter status topic shared by all its
+// devices.
+func (r *DeviceRegistry) SetAvailability(topic, payload string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for _, rec := range r.devices {
+		if !slices.Contains(availabilityTopics(rec.Meta), topic) || rec.AvailabilityTopics[topic] == payload {
+			continue
+		}
+		if rec.AvailabilityTopics == nil {
+			rec.AvailabilityTopics = map[string]string{}
+		}
+		rec.AvailabilityTopics[topic] = payload
+		rec.Availability = rec.availability()
+		rec.LastSeen = time.Now().UTC()
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.save()
+}
+
+// availability is "online" if every availability topic is, matching the
+// "all" availability mode of the discovery configs, "offline" if any is
+// offline and unknown otherwise.
+func (rec *DeviceRecord) availability() string {
+	state := "online"
+	for _, t := range availabilityTopics(rec.Meta) {
+		switch rec.AvailabilityTopics[t] {
+		case "online":
+		case "offline":
+			return "offline"
+		default:
+			state = ""
+		}
+	}
+	return state
+}
+
+// availabilityTopics returns the online/offline topics of a device,
+// smh/<device>/availability for metas that list none.
+func availabilityTopics(meta capability.Meta) []string {
+	if len(meta.Availability) > 0 {
+		return meta.Availability
+	}
+	return []string{"smh/" + meta.DeviceID + "/availability"}
+}
+
+// AvailabilityTopics returns the availability topics of every known device.
+func (r *DeviceRegistry) AvailabilityTopics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := map[string]bool{}
+	var topics []string
+	for _, rec := range r.sorted() {
+		for _, t := range availabilityTopics(rec.Meta) {
+			if !seen[t] {
+				seen[t] = true
+				topics = append(topics, t)
+			}
+		}
+	}
+	return topics
+}
+
+// Touch marks a known device as seen. The file is rewritten at most once
+// per touchSaveInterval for touches alone.
+func (r *DeviceRegistry) Touch(deviceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	rec.LastSeen = time.Now().UTC()
+	r.dirty = true
+	if time.Since(r.savedAt) < touchSaveInterval {
+		return nil
+	}
+	return r.save()
+}
+
+// SetDiscovery records the discovery topics just published for a known
+// device and returns the previously published ones that are now obsolete.
+func (r *DeviceRegistry) SetDiscovery(deviceID string, topics []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.devices[deviceID]
+	if !ok {
+		return nil, nil
+	}
+	current := map[string]bool{}
+	for _, t := range topics {
+		current[t] = true
+	}
+	var obsolete []string
+	for _, t := range rec.Discovery {
+		if !current[t] {
+			obsolete = append(obsolete, t)
+		}
+	}
+	if slices.Equal(rec.Discovery, topics) {
+		return nil, nil
+	}
+	rec.Discovery = topics
+	return obsolete, r.save()
+}
+
+// Remove forgets a device and returns its last record.
+func (r *DeviceRegistry) Remove(deviceID string) (DeviceRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.devices[deviceID]
+	if !ok {
+		return DeviceRecord{}, false, nil
+	}
+	delete(r.devices, deviceID)
+	return *rec, true, r.save()
+}
+
+// Get returns the record of a device.
+func (r *DeviceRegistry) Get(deviceID string) (DeviceRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.devices[deviceID]
+	if !ok {
+		return DeviceRecord{}, false
+	}
+	c := *rec
+	c.AvailabilityTopics = maps.Clone(rec.AvailabilityTopics)
+	return c, true
+}
+
+// All returns the known devices ordered by ID.
+func (r *DeviceRegistry) All() []capability.Meta {
+	records := r.Records()
+	all := make([]capability.Meta, len(records))
+	for i, rec := range records {
+		all[i] = rec.Meta
+	}
+	return all
+}
+
+// Records returns a copy of every record ordered by device ID.
+func (r *DeviceRegistry) Records() []DeviceRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sorted()
+}
+
+// Close writes pending touches to disk.
+func (r *DeviceRegistry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	return r.save()
+}
+
+func (r *DeviceRegistry) sorted() []DeviceRecord {
+	all := make([]DeviceRecord, 0, len(r.devices))
+	for _, rec := range r.devices {
+		c := *rec
+		c.AvailabilityTopics = maps.Clone(rec.AvailabilityTopics)
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Meta.DeviceID < all[j].Meta.DeviceID })
+	return all
+}
+
+// save atomically replaces the registry file. Callers must hold r.mu.
+func (r *DeviceRegistry) save() error {
+	b, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return err
+	}
+	r.dirty = false
+	r.savedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+)
+
+func TestDeviceRegistry_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	r, err := OpenDeviceRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := capability.Meta{DeviceID: "cw100.inverter", Model: "CW100", Area: "lab", Caps: []string{"sensor.voltage"}}
+	if err := r.Put(meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetAvailability("smh/cw100.inverter/availability", "online"); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := r.Get("cw100.inverter")
+
+	// a second announcement keeps first_seen
+	if err := r.Put(meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = OpenDeviceRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := r.Get("cw100.inverter")
+	if !ok {
+		t.Fatal("device lost across restart")
+	}
+	if !reflect.DeepEqual(rec.Meta, meta) || rec.Availability != "online" || !rec.FirstSeen.Equal(first.FirstSeen) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.LastSeen.Before(rec.FirstSeen) {
+		t.Fatalf("last seen %v before first seen %v", rec.LastSeen, rec.FirstSeen)
+	}
+}
+
+func TestDeviceRegistry_OfflineThroughStatusTopic(t *testing.T) {
+	r, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := "smh/adapter-1/status"
+	for _, id := range []string{"meter.1", "meter.2"} {
+		meta := capability.Meta{DeviceID: id, Availability: []string{"smh/" + id + "/availability", status}}
+		if err := r.Put(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	availability := func(id string) string {
+		rec, _ := r.Get(id)
+		return rec.Availability
+	}
+
+	if err := r.SetAvailability("smh/meter.1/availability", "online"); err != nil {
+		t.Fatal(err)
+	}
+	if got := availability("meter.1"); got != "" {
+		t.Fatalf("online before the status topic is known: %q", got)
+	}
+	for _, topic := range []string{status, "smh/meter.2/availability"} {
+		if err := r.SetAvailability(topic, "online"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if availability("meter.1") != "online" || availability("meter.2") != "online" {
+		t.Fatalf("want both online, got %q and %q", availability("meter.1"), availability("meter.2"))
+	}
+
+	// the adapter dies: its retained availability stays online, the broker
+	// publishes the Last Will on the status topic
+	if err := r.SetAvailability(status, "offline"); err != nil {
+		t.Fatal(err)
+	}
+	if availability("meter.1") != "offline" || availability("meter.2") != "offline" {
+		t.Fatalf("want both offline, got %q and %q", availability("meter.1"), availability("meter.2"))
+	}
+}
+
+func TestDeviceRegistry_IgnoresUnknownDevices(t *testing.T) {
+	r, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetAvailability("smh/ghost/availability", "online"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Touch("ghost"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Records()) != 0 {
+		t.Fatalf("unexpected records %+v", r.Records())
+	}
+}
+
+func TestDeviceRegistry_SetDiscoveryReturnsObsoleteTopics(t *testing.T) {
+	r, err := OpenDeviceRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(capability.Meta{DeviceID: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SetDiscovery("dev", []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	obsolete, err := r.SetDiscovery("dev", []string{"a", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(obsolete, []string{"b"}) {
+		t.Fatalf("obsolete = %v, want [b]", obsolete)
+	}
+
+	rec, ok, err := r.Remove("dev")
+	if err != nil || !ok {
+		t.Fatalf("remove: %v %v", ok, err)
+	}
+	if !reflect.DeepEqual(rec.Discovery, []string{"a", "c", "d"}) {
+		t.Fatalf("discovery = %v", rec.Discovery)
+	}
+	if _, ok := r.Get("dev"); ok {
+		t.Fatal("device still registered after remove")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+	"github.com/tetragramaton/smh-go/internal/interface/mqtt"
+)
+
+// MetaError is published to smh/<device>/meta/error when core rejects an
+// announcement, so adapter authors can see what is wrong.
+type MetaError struct {
+	Ts       int64        `json:"ts"`
+	DeviceID string       `json:"device_id"`
+	Errors   []FieldError `json:"errors"`
+}
+
+// FieldError names the offending meta field, e.g. "points[2].field".
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// validateMeta checks a meta received on smh/<deviceID>/meta.
+func validateMeta(deviceID string, meta capability.Meta) []FieldError {
+	var errs []FieldError
+	bad := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	check := func(field string, err error) {
+		if err != nil {
+			bad(field, "%v", err)
+		}
+	}
+
+	check("device_id", capability.CheckID(meta.DeviceID))
+	if meta.DeviceID != "" && meta.DeviceID != deviceID {
+		bad("device_id", "%q does not match topic device %q", meta.DeviceID, deviceID)
+	}
+	if len(meta.Model) > capability.MaxTextLen {
+		bad("model", "longer than %d characters", capability.MaxTextLen)
+	}
+	if len(meta.Area) > capability.MaxTextLen {
+		bad("area", "longer than %d characters", capability.MaxTextLen)
+	}
+
+	// caps must be declared or described by points
+	described := map[string]bool{}
+	for _, p := range meta.Points {
+		described[p.Cap] = true
+	}
+	caps := map[string]bool{}
+	switch {
+	case len(meta.Caps) == 0:
+		bad("caps", "required")
+	case len(meta.Caps) > capability.MaxCaps:
+		bad("caps", "more than %d caps", capability.MaxCaps)
+	}
+	for i, c := range meta.Caps {
+		field := fmt.Sprintf("caps[%d]", i)
+		_, declared := capability.Lookup(c)
+		err := capability.CheckCap(c)
+		switch {
+		case err != nil:
+			bad(field, "%v", err)
+		case caps[c]:
+			bad(field, "duplicate cap %q", c)
+		case !declared && !described[c]:
+			bad(field, "unknown cap %q without points", c)
+		}
+		caps[c] = true
+	}
+
+	if len(meta.Points) > capability.MaxPoints {
+		bad("points", "more than %d points", capability.MaxPoints)
+	}
+	ids := map[string]bool{}
+	fields := map[string]bool{}
+	for i, p := range meta.Points {
+		prefix := fmt.Sprintf("points[%d]", i)
+		check(prefix+".id", capability.CheckID(p.ID))
+		if ids[p.ID] {
+			bad(prefix+".id", "duplicate id %q", p.ID)
+		}
+		ids[p.ID] = true
+		if !caps[p.Cap] {
+			bad(prefix+".cap", "cap %q is not listed in caps", p.Cap)
+		}
+		err := capability.CheckField(p.Field)
+		switch {
+		case err != nil:
+			bad(prefix+".field", "%v", err)
+		case fields[p.Cap+"/"+p.Field]:
+			bad(prefix+".field", "duplicate field %q in cap %q", p.Field, p.Cap)
+		}
+		fields[p.Cap+"/"+p.Field] = true
+		if capDef, ok := capability.Lookup(p.Cap); ok {
+			if _, ok := capDef.Field(p.Field); !ok {
+				bad(prefix+".field", "cap %q has no field %q", p.Cap, p.Field)
+			}
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			bad(prefix+".min", "min %v is greater than max %v", *p.Min, *p.Max)
+		}
+		for j, o := range p.Options {
+			check(fmt.Sprintf("%s.options[%d]", prefix, j), capability.CheckOption(o))
+		}
+	}
+
+	for i, t := range meta.Availability {
+		if t == "" || strings.ContainsAny(t, "+#") {
+			bad(fmt.Sprintf("availability[%d]", i), "invalid topic %q", t)
+		}
+	}
+	return errs
+}
+
+// validateState checks a state payload of a registered device received on
+// topic, either smh/<device>/state or smh/<device>/<cap>/state.
+func validateState(topic string, payload []byte, meta capability.Meta) error {
+	var st map[string]any
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, ok := st[capability.KeyTs].(float64); !ok {
+		return errors.New("missing numeric " + capability.KeyTs)
+	}
+	c, ok := st[capability.KeyCap].(string)
+	if !ok {
+		return errors.New("missing " + capability.KeyCap)
+	}
+	if parts := strings.Split(topic, "/"); len(parts) == 4 && parts[2] != c {
+		return fmt.Errorf("cap %q published on the topic of %q", c, parts[2])
+	}
+	for _, known := range meta.Caps {
+		if known == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("cap %q is not announced in the meta", c)
+}
+
+// publishMetaError reports a rejected meta on smh/<device>/meta/error. The
+// message is retained until the device announces a valid meta.
+func (h *MainHandler) publishMetaError(deviceID string, errs []FieldError) {
+	b, err := json.Marshal(MetaError{Ts: time.Now().Unix(), DeviceID: deviceID, Errors: errs})
+	if err != nil {
+		return
+	}
+	if err := h.MQQTClient.PublishEvent(mqtt.Message{
+		Topic:   "smh/" + deviceID + "/meta/error",
+		Payload: b,
+		QoS:     1,
+		Retain:  true,
+	}); err != nil {
+		slog.Error("publish meta error", "device_id", deviceID, "err", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+)
+
+func TestValidateMeta(t *testing.T) {
+	valid := capability.Meta{
+		DeviceID: "cw100.inverter",
+		Caps:     []string{"energy.meter", "switch.relay"},
+		Points: []capability.PointMeta{
+			{ID: "power", Cap: "energy.meter", Field: "power_w"},
+			{ID: "relay1", Cap: "switch.relay", Field: "relay1", Binary: true, Writable: true},
+		},
+	}
+	if errs := validateMeta("cw100.inverter", valid); len(errs) != 0 {
+		t.Fatalf("valid meta rejected: %+v", errs)
+	}
+
+	cases := []struct {
+		name  string
+		topic string
+		meta  capability.Meta
+		want  string
+	}{
+		{"empty id", "x", capability.Meta{Caps: []string{"sensor.voltage"}}, "device_id: required"},
+		{"topic mismatch", "other", capability.Meta{DeviceID: "dev", Caps: []string{"sensor.voltage"}}, `does not match topic device "other"`},
+		{"bad id", "a b", capability.Meta{DeviceID: "a b", Caps: []string{"sensor.voltage"}}, "may only contain"},
+		{"no caps", "dev", capability.Meta{DeviceID: "dev"}, "caps: required"},
+		{"unknown cap", "dev", capability.Meta{DeviceID: "dev", Caps: []string{"sensor.humidity"}}, `unknown cap "sensor.humidity"`},
+		{"bad field", "dev", capability.Meta{DeviceID: "dev", Caps: []string{"x"},
+			Points: []capability.PointMeta{{ID: "p", Cap: "x", Field: "a-b"}}}, `points[0].field: invalid field "a-b"`},
+		{"cap not listed", "dev", capability.Meta{DeviceID: "dev", Caps: []string{"sensor.voltage"},
+			Points: []capability.PointMeta{{ID: "p", Cap: "y", Field: "value"}}}, `points[0].cap: cap "y" is not listed`},
+	}
+	for _, c := range cases {
+		errs := validateMeta(c.topic, c.meta)
+		var msgs []string
+		for _, e := range errs {
+			msgs = append(msgs, e.Field+": "+e.Message)
+		}
+		if !strings.Contains(strings.Join(msgs, "\n"), c.want) {
+			t.Errorf("%s: errors %q do not mention %q", c.name, msgs, c.want)
+		}
+	}
+}
+
+func TestValidateState(t *testing.T) {
+	meta := capability.Meta{DeviceID: "dev", Caps: []string{"sensor.voltage"}}
+	if err := validateState("smh/dev/state", []byte(`{"ts":1,"cap":"sensor.voltage","value":230}`), meta); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ topic, payload string }{
+		{"smh/dev/state", `{"ts":1,"cap":"sensor.current","value":1}`},
+		{"smh/dev/sensor.current/state", `{"ts":1,"cap":"sensor.voltage","value":230}`},
+		{"smh/dev/sensor.voltage/state", `{"cap":"sensor.voltage","value":230}`},
+		{"smh/dev/state", `not json`},
+	} {
+		if err := validateState(c.topic, []byte(c.payload), meta); err == nil {
+			t.Errorf("%s %s: expected error", c.topic, c.payload)
+		}
+	}
+}
@@ -4,6 +4,8 @@
 package main
 
 import (
+	"sync"
+
 	"github.com/google/wire"
 	"github.com/tetragramaton/smh-go/internal/client/mqtt"
 	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
@@ -11,13 +13,19 @@ import (
 
 type MainHandler struct {
 	MQQTClient mqttIface.Client
+	Registry   *DeviceRegistry
+
+	watchMu sync.Mutex
+	watched map[string]bool // availability topics subscribed to
 }
 
 func NewMainHandler(
 	mqttClient mqttIface.Client,
+	registry *DeviceRegistry,
 ) *MainHandler {
 	return &MainHandler{
 		MQQTClient: mqttClient,
+		Registry:   registry,
 	}
 }
 
@@ -25,6 +33,7 @@ func InitMainHandler() (*MainHandler, error) {
 	wire.Build(
 		NewMainHandler,
 		ProvideMqttClient,
+		ProvideDeviceRegistry,
 	)
 	return nil, nil // wire will generate the result
 }
@@ -32,3 +41,7 @@ func InitMainHandler() (*MainHandler, error) {
 func ProvideMqttClient() (mqttIface.Client, error) {
 	return mqtt.NewClient()
 }
+
+func ProvideDeviceRegistry() (*DeviceRegistry, error) {
+	return OpenDeviceRegistry(getenv("REGISTRY_FILE", "smh-registry.json"))
+}
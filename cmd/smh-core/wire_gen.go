@@ -9,6 +9,7 @@ package main
 import (
 	mqtt2 "github.com/tetragramaton/smh-go/internal/client/mqtt"
 	"github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	"sync"
 )
 
 // Injectors from wire.go:
@@ -18,7 +19,11 @@ func InitMainHandler() (*MainHandler, error) {
 	if err != nil {
 		return nil, err
 	}
-	mainHandler := NewMainHandler(client)
+	deviceRegistry, err := ProvideDeviceRegistry()
+	if err != nil {
+		return nil, err
+	}
+	mainHandler := NewMainHandler(client, deviceRegistry)
 	return mainHandler, nil
 }
 
@@ -26,16 +31,26 @@ func InitMainHandler() (*MainHandler, error) {
 
 type MainHandler struct {
 	MQQTClient mqtt.Client
+	Registry   *DeviceRegistry
+
+	watchMu sync.Mutex
+	watched map[string]bool // availability topics subscribed to
 }
 
 func NewMainHandler(
 	mqttClient mqtt.Client,
+	registry *DeviceRegistry,
 ) *MainHandler {
 	return &MainHandler{
 		MQQTClient: mqttClient,
+		Registry:   registry,
 	}
 }
 
 func ProvideMqttClient() (mqtt.Client, error) {
 	return mqtt2.NewClient()
 }
+
+func ProvideDeviceRegistry() (*DeviceRegistry, error) {
+	return OpenDeviceRegistry(getenv("REGISTRY_FILE", "smh-registry.json"))
+}
@@ -0,0 +1,100 @@
+// Package capability declares the payloads shared by adapters and core: the
+// device meta, the state payload each capability publishes and how Home
+// Assistant shows it.
+package capability
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tetragramaton/smh-go/internal/client/ha"
+)
+
+// Keys of every state payload besides the capability fields.
+const (
+	KeyTs   = "ts"
+	KeyCap  = "cap"
+	KeyUnit = "unit"
+)
+
+// Field is one value of a capability state payload.
+type Field struct {
+	Name        string // key in the state payload
+	Label       string // entity name suffix
+	Unit        string
+	DeviceClass string
+	StateClass  string // one of the ha.StateClass constants
+	// Object and UniqueSuffix name the discovery topic and unique_id of
+	// the entity; they must not change once released.
+	Object       string
+	UniqueSuffix string
+}
+
+// Capability is a named group of fields published in one state message.
+type Capability struct {
+	Name   string
+	Fields []Field
+}
+
+var registry = map[string]Capability{}
+
+func register(c Capability) {
+	if _, ok := registry[c.Name]; ok {
+		panic("capability: duplicate " + c.Name)
+	}
+	registry[c.Name] = c
+}
+
+func init() {
+	register(Capability{Name: "energy.meter", Fields: []Field{
+		{Name: "power_w", Label: "power", Unit: "W", DeviceClass: "power", StateClass: ha.StateClassMeasurement,
+			Object: "power_w", UniqueSuffix: "_power"},
+		{Name: "energy_kwh", Label: "energy", Unit: "kWh", DeviceClass: "energy", StateClass: ha.StateClassTotalIncreasing,
+			Object: "energy_kwh", UniqueSuffix: "_energy"},
+	}})
+	register(Capability{Name: "sensor.frequency", Fields: []Field{
+		{Name: "value", Label: "frequency", Unit: "Hz", DeviceClass: "frequency", StateClass: ha.StateClassMeasurement,
+			Object: "frequency", UniqueSuffix: "_freq"},
+	}})
+	register(Capability{Name: "sensor.voltage", Fields: []Field{
+		{Name: "value", Label: "voltage", Unit: "V", DeviceClass: "voltage", StateClass: ha.StateClassMeasurement,
+			Object: "voltage", UniqueSuffix: "_volt"},
+	}})
+	register(Capability{Name: "sensor.current", Fields: []Field{
+		{Name: "value", Label: "current", Unit: "A", DeviceClass: "current", StateClass: ha.StateClassMeasurement,
+			Object: "current", UniqueSuffix: "_current"},
+	}})
+}
+
+// Lookup returns the declared capability called name.
+func Lookup(name string) (Capability, bool) {
+	c, ok := registry[name]
+	return c, ok
+}
+
+// Names lists the declared capabilities.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Field returns the declared field called name.
+func (c Capability) Field(name string) (Field, bool) {
+	for _, f := range c.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Template wraps a Home Assistant template expression so it only renders
+// for state messages of capability name; other capabilities share the
+// state topic.
+func Template(name, expr string) string {
+	return fmt.Sprintf("{{ %s if value_json.%s == %q }}", expr, KeyCap, name)
+}
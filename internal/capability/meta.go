@@ -0,0 +1,32 @@
+package capability
+
+// Meta is the retained announcement of a device on smh/<device>/meta,
+// published by adapters and turned into discovery by core.
+type Meta struct {
+	DeviceID string      `json:"device_id"`
+	Model    string      `json:"model,omitempty"`
+	Area     string      `json:"area,omitempty"`
+	Caps     []string    `json:"caps"`
+	Points   []PointMeta `json:"points,omitempty"`
+	// PerCapState is set when each cap is also published retained on
+	// smh/<device>/<cap>/state.
+	PerCapState bool `json:"per_cap_state,omitempty"`
+	// Availability lists online/offline topics that must all be online
+	// for the device to be available.
+	Availability []string `json:"availability,omitempty"`
+}
+
+// PointMeta describes a single point so core can build per-point entities.
+type PointMeta struct {
+	ID       string `json:"id"`
+	Cap      string `json:"cap"`
+	Field    string `json:"field"` // key in the state payload of Cap
+	Unit     string `json:"unit,omitempty"`
+	Binary   bool   `json:"binary,omitempty"`
+	Writable bool   `json:"writable,omitempty"`
+	// Precision, write range and option labels of the point.
+	Precision int      `json:"precision,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Options   []string `json:"options,omitempty"`
+}
@@ -0,0 +1,62 @@
+package capability
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Limits of a meta. Adapters check their maps against them so every device
+// they announce is accepted by core.
+const (
+	MaxIDLen   = 64
+	MaxTextLen = 128
+	MaxCaps    = 64
+	MaxPoints  = 512
+)
+
+var (
+	// IDs end up in topics, unique_ids and entity names.
+	idRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	// caps are dotted lower case names such as "sensor.voltage".
+	capRe = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+	// fields are referenced as value_json.<field> in HA templates.
+	fieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// CheckID validates a device or point ID.
+func CheckID(id string) error {
+	switch {
+	case id == "":
+		return errors.New("required")
+	case len(id) > MaxIDLen:
+		return fmt.Errorf("longer than %d characters", MaxIDLen)
+	case !idRe.MatchString(id):
+		return fmt.Errorf("%q may only contain letters, digits, '_', '.' and '-'", id)
+	}
+	return nil
+}
+
+// CheckCap validates a capability name.
+func CheckCap(c string) error {
+	if len(c) > MaxIDLen || !capRe.MatchString(c) {
+		return fmt.Errorf("invalid cap %q", c)
+	}
+	return nil
+}
+
+// CheckField validates the state payload key of a point.
+func CheckField(f string) error {
+	if !fieldRe.MatchString(f) {
+		return fmt.Errorf("invalid field %q", f)
+	}
+	return nil
+}
+
+// CheckOption validates an option label of an enumerated point.
+func CheckOption(o string) error {
+	if o == "" || len(o) > MaxTextLen {
+		return fmt.Errorf("invalid option %q", o)
+	}
+	return nil
+}
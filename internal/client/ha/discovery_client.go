@@ -5,6 +5,17 @@ import (
 	"fmt"
 )
 
+// Home Assistant MQTT discovery components.
+const (
+	ComponentSensor       = "sensor"
+	ComponentBinarySensor = "binary_sensor"
+	ComponentSwitch       = "switch"
+	ComponentNumber       = "number"
+	ComponentSelect       = "select"
+	ComponentButton       = "button"
+	ComponentClimate      = "climate"
+)
+
 type Device struct {
 	Identifiers  []string `json:"identifiers,omitempty"`
 	Manufacturer string   `json:"manufacturer,omitempty"`
@@ -12,19 +23,57 @@ type Device struct {
 	Name         string   `json:"name,omitempty"`
 }
 
+// Config is the discovery payload of one entity.
+type Config interface {
+	Base() *Entity
+	Component() string
+	Marshal() ([]byte, error)
+}
+
+// Entity holds the fields shared by every component.
+type Entity struct {
+	Name         string              `json:"name"`
+	UniqueID     string              `json:"unique_id"`
+	Device       *Device             `json:"device,omitempty"`
+	QoS          int                 `json:"qos,omitempty"`
+	Availability []map[string]string `json:"availability,omitempty"`
+	// AvailabilityMode is "all", "any" or "latest" when several
+	// availability topics are given.
+	AvailabilityMode string `json:"availability_mode,omitempty"`
+	Icon             string `json:"icon,omitempty"`            // e.g. mdi:flash
+	EntityCategory   string `json:"entity_category,omitempty"` // config or diagnostic
+}
+
+// Sensor state classes; the Energy dashboard needs total or
+// total_increasing on energy sensors.
+const (
+	StateClassMeasurement     = "measurement"
+	StateClassTotal           = "total"
+	StateClassTotalIncreasing = "total_increasing"
+)
+
+// Base returns the entity itself so callers can fill the shared fields of
+// any Config.
+func (e *Entity) Base() *Entity { return e }
+
 type SensorConfig struct {
-	Name         string                 `json:"name"`
-	UniqueID     string                 `json:"unique_id"`
-	StateTopic   string                 `json:"state_topic"`
-	ValueTpl     string                 `json:"value_template,omitempty"`
-	DeviceClass  string                 `json:"device_class,omitempty"`
-	UnitOfMeas   string                 `json:"unit_of_measurement,omitempty"`
-	Device       *Device                `json:"device,omitempty"`
-	QoS          int                    `json:"qos,omitempty"`
-	Availability []map[string]string    `json:"availability,omitempty"`
-	Extra        map[string]interface{} `json:"-"`
+	Entity
+	StateTopic  string `json:"state_topic"`
+	ValueTpl    string `json:"value_template,omitempty"`
+	DeviceClass string `json:"device_class,omitempty"`
+	UnitOfMeas  string `json:"unit_of_measurement,omitempty"`
+	StateClass  string `json:"state_class,omitempty"`
+	// SuggestedPrecision is the number of decimals HA displays.
+	SuggestedPrecision *int `json:"suggested_display_precision,omitempty"`
+	// ExpireAfter marks the state unavailable after that many seconds
+	// without an update.
+	ExpireAfter int                    `json:"expire_after,omitempty"`
+	ForceUpdate bool                   `json:"force_update,omitempty"`
+	Extra       map[string]interface{} `json:"-"`
 }
 
+func (c *SensorConfig) Component() string { return ComponentSensor }
+
 func (c *SensorConfig) Marshal() ([]byte, error) {
 	type alias SensorConfig
 	a := alias(*c)
@@ -45,6 +94,121 @@ func (c *SensorConfig) Marshal() ([]byte, error) {
 	return b, nil
 }
 
+// BinarySensorConfig is a read-only on/off entity. The value template must
+// render PayloadOn or PayloadOff ("ON"/"OFF" if empty).
+type BinarySensorConfig struct {
+	Entity
+	StateTopic  string `json:"state_topic"`
+	ValueTpl    string `json:"value_template,omitempty"`
+	DeviceClass string `json:"device_class,omitempty"`
+	PayloadOn   string `json:"payload_on,omitempty"`
+	PayloadOff  string `json:"payload_off,omitempty"`
+}
+
+func (c *BinarySensorConfig) Component() string { return ComponentBinarySensor }
+
+func (c *BinarySensorConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+// SwitchConfig is a controllable on/off entity. PayloadOn/PayloadOff are
+// sent to CommandTopic; the state template must render StateOn/StateOff
+// (the payloads if empty).
+type SwitchConfig struct {
+	Entity
+	StateTopic   string `json:"state_topic,omitempty"`
+	ValueTpl     string `json:"value_template,omitempty"`
+	CommandTopic string `json:"command_topic"`
+	DeviceClass  string `json:"device_class,omitempty"`
+	PayloadOn    string `json:"payload_on,omitempty"`
+	PayloadOff   string `json:"payload_off,omitempty"`
+	StateOn      string `json:"state_on,omitempty"`
+	StateOff     string `json:"state_off,omitempty"`
+}
+
+func (c *SwitchConfig) Component() string { return ComponentSwitch }
+
+func (c *SwitchConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+// NumberConfig is a numeric setpoint written to CommandTopic.
+type NumberConfig struct {
+	Entity
+	StateTopic   string   `json:"state_topic,omitempty"`
+	ValueTpl     string   `json:"value_template,omitempty"`
+	CommandTopic string   `json:"command_topic"`
+	DeviceClass  string   `json:"device_class,omitempty"`
+	UnitOfMeas   string   `json:"unit_of_measurement,omitempty"`
+	Min          *float64 `json:"min,omitempty"` // HA default 1
+	Max          *float64 `json:"max,omitempty"` // HA default 100
+	Step         float64  `json:"step,omitempty"`
+	Mode         string   `json:"mode,omitempty"` // auto, box or slider
+}
+
+func (c *NumberConfig) Component() string { return ComponentNumber }
+
+func (c *NumberConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+// SelectConfig picks one of Options. The value template must render an
+// option; CommandTpl maps the selected option to the command payload.
+type SelectConfig struct {
+	Entity
+	StateTopic   string   `json:"state_topic,omitempty"`
+	ValueTpl     string   `json:"value_template,omitempty"`
+	CommandTopic string   `json:"command_topic"`
+	CommandTpl   string   `json:"command_template,omitempty"`
+	Options      []string `json:"options"`
+}
+
+func (c *SelectConfig) Component() string { return ComponentSelect }
+
+func (c *SelectConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+// ButtonConfig sends PayloadPress ("PRESS" if empty) to CommandTopic.
+type ButtonConfig struct {
+	Entity
+	CommandTopic string `json:"command_topic"`
+	PayloadPress string `json:"payload_press,omitempty"`
+	DeviceClass  string `json:"device_class,omitempty"`
+}
+
+func (c *ButtonConfig) Component() string { return ComponentButton }
+
+func (c *ButtonConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
+// ClimateConfig is a thermostat with a current temperature, a target
+// temperature and optionally an HVAC mode.
+type ClimateConfig struct {
+	Entity
+	CurrentTempTopic string   `json:"current_temperature_topic,omitempty"`
+	CurrentTempTpl   string   `json:"current_temperature_template,omitempty"`
+	TempStateTopic   string   `json:"temperature_state_topic,omitempty"`
+	TempStateTpl     string   `json:"temperature_state_template,omitempty"`
+	TempCommandTopic string   `json:"temperature_command_topic,omitempty"`
+	ModeStateTopic   string   `json:"mode_state_topic,omitempty"`
+	ModeStateTpl     string   `json:"mode_state_template,omitempty"`
+	ModeCommandTopic string   `json:"mode_command_topic,omitempty"`
+	ModeCommandTpl   string   `json:"mode_command_template,omitempty"`
+	Modes            []string `json:"modes,omitempty"`
+	MinTemp          *float64 `json:"min_temp,omitempty"`
+	MaxTemp          *float64 `json:"max_temp,omitempty"`
+	TempStep         float64  `json:"temp_step,omitempty"`
+	TempUnit         string   `json:"temperature_unit,omitempty"` // C or F
+	Precision        float64  `json:"precision,omitempty"`        // 0.1, 0.5 or 1
+}
+
+func (c *ClimateConfig) Component() string { return ComponentClimate }
+
+func (c *ClimateConfig) Marshal() ([]byte, error) { return json.Marshal(c) }
+
 func TopicSensorConfig(cap, unique string) string {
-	return fmt.Sprintf("homeassistant/sensor/%s/%s/config", unique, cap)
+	return TopicConfig(ComponentSensor, cap, unique)
+}
+
+// TopicConfig returns the discovery topic of an entity of the given
+// Home Assistant component (sensor, binary_sensor, switch, ...).
+func TopicConfig(component, object, unique string) string {
+	return fmt.Sprintf("homeassistant/%s/%s/%s/config", component, unique, object)
+}
+
+// Topic returns the discovery topic of cfg.
+func Topic(cfg Config, object, unique string) string {
+	return TopicConfig(cfg.Component(), object, unique)
 }
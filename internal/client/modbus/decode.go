@@ -0,0 +1,144 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+// decode interprets raw register bytes (as received on the wire) according
+// to the data type and byte order of param and returns the unscaled value.
+func decode(raw []byte, param modbusIface.RegisterParam) (float64, error) {
+	n := int(param.Type.Registers())
+	if n == 0 {
+		return 0, fmt.Errorf("unsupported data type %q", param.Type)
+	}
+	if len(raw) < 2*n {
+		return 0, fmt.Errorf("short response: want %d bytes, got %d", 2*n, len(raw))
+	}
+	b, err := reorder(raw[:2*n], param.Order)
+	if err != nil {
+		return 0, err
+	}
+
+	switch param.Type {
+	case modbusIface.TypeUint16:
+		return float64(binary.BigEndian.Uint16(b)), nil
+	case modbusIface.TypeInt32:
+		return float64(int32(binary.BigEndian.Uint32(b))), nil
+	case modbusIface.TypeUint32:
+		return float64(binary.BigEndian.Uint32(b)), nil
+	case modbusIface.TypeFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case modbusIface.TypeInt64:
+		return float64(int64(binary.BigEndian.Uint64(b))), nil
+	case modbusIface.TypeUint64:
+		return float64(binary.BigEndian.Uint64(b)), nil
+	case modbusIface.TypeFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	default:
+		return float64(int16(binary.BigEndian.Uint16(b))), nil
+	}
+}
+
+// reorder returns a big endian copy of raw. Word swaps reverse the register
+// order, byte swaps exchange the two bytes inside every register.
+func reorder(raw []byte, order modbusIface.ByteOrder) ([]byte, error) {
+	var swapWords, swapBytes bool
+	switch order {
+	case modbusIface.OrderABCD, "":
+	case modbusIface.OrderCDAB:
+		swapWords = true
+	case modbusIface.OrderBADC:
+		swapBytes = true
+	case modbusIface.OrderDCBA:
+		swapWords, swapBytes = true, true
+	default:
+		return nil, fmt.Errorf("unsupported byte order %q", order)
+	}
+
+	n := len(raw) / 2
+	b := make([]byte, len(raw))
+	for i := 0; i < n; i++ {
+		src := i
+		if swapWords {
+			src = n - 1 - i
+		}
+		hi, lo := raw[2*src], raw[2*src+1]
+		if swapBytes {
+			hi, lo = lo, hi
+		}
+		b[2*i], b[2*i+1] = hi, lo
+	}
+	return b, nil
+}
+
+// encode is the inverse of decode: it converts an unscaled value into raw
+// register bytes in the byte order of param.
+func encode(v float64, param modbusIface.RegisterParam) ([]byte, error) {
+	n := int(param.Type.Registers())
+	if n == 0 {
+		return nil, fmt.Errorf("unsupported data type %q", param.Type)
+	}
+	b := make([]byte, 2*n)
+
+	switch param.Type {
+	case modbusIface.TypeFloat32:
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(v)))
+	case modbusIface.TypeFloat64:
+		binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	default:
+		i := math.Round(v)
+		lo, hi := intRange(param.Type)
+		if i < lo || i >= hi {
+			return nil, fmt.Errorf("value %v out of %s range", v, param.Type)
+		}
+		switch param.Type {
+		case modbusIface.TypeUint16:
+			binary.BigEndian.PutUint16(b, uint16(i))
+		case modbusIface.TypeInt32:
+			binary.BigEndian.PutUint32(b, uint32(int32(i)))
+		case modbusIface.TypeUint32:
+			binary.BigEndian.PutUint32(b, uint32(i))
+		case modbusIface.TypeInt64:
+			binary.BigEndian.PutUint64(b, uint64(int64(i)))
+		case modbusIface.TypeUint64:
+			binary.BigEndian.PutUint64(b, uint64(i))
+		default:
+			binary.BigEndian.PutUint16(b, uint16(int16(i)))
+		}
+	}
+	// every supported order swaps words and/or bytes, so it is its own inverse
+	return reorder(b, param.Order)
+}
+
+// intRange returns the range [lo, hi) of an integer type. hi is exclusive
+// so it stays exact in a float64: math.MaxInt64 and math.MaxUint64 round up
+// to 2^63 and 2^64, which do not fit.
+func intRange(t modbusIface.DataType) (lo, hi float64) {
+	switch t {
+	case modbusIface.TypeUint16:
+		return 0, 1 << 16
+	case modbusIface.TypeInt32:
+		return math.MinInt32, 1 << 31
+	case modbusIface.TypeUint32:
+		return 0, 1 << 32
+	case modbusIface.TypeInt64:
+		return math.MinInt64, 1 << 63
+	case modbusIface.TypeUint64:
+		return 0, 1 << 64
+	default:
+		return math.MinInt16, 1 << 15
+	}
+}
+
+// decodeBit returns bit n of a coil or discrete input response, where bits
+// are packed least significant first.
+func decodeBit(raw []byte, n int) (float64, error) {
+	if n/8 >= len(raw) {
+		return 0, fmt.Errorf("short response: want bit %d, got %d bytes", n, len(raw))
+	}
+	return float64(raw[n/8] >> (n % 8) & 1), nil
+}
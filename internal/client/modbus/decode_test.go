@@ -0,0 +1,102 @@
+package modbus
+
+import (
+	"math"
+	"testing"
+
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   []byte
+		typ   modbusIface.DataType
+		order modbusIface.ByteOrder
+		want  float64
+	}{
+		{"int16 negative", []byte{0xFF, 0xFE}, modbusIface.TypeInt16, "", -2},
+		{"uint16", []byte{0xFF, 0xFE}, modbusIface.TypeUint16, "", 65534},
+		{"uint16 BADC", []byte{0x34, 0x12}, modbusIface.TypeUint16, modbusIface.OrderBADC, 0x1234},
+		{"uint32 ABCD", []byte{0x00, 0x01, 0x86, 0xA0}, modbusIface.TypeUint32, modbusIface.OrderABCD, 100000},
+		{"uint32 CDAB", []byte{0x86, 0xA0, 0x00, 0x01}, modbusIface.TypeUint32, modbusIface.OrderCDAB, 100000},
+		{"int32 DCBA", []byte{0xFE, 0xFF, 0xFF, 0xFF}, modbusIface.TypeInt32, modbusIface.OrderDCBA, -2},
+		{"float32 ABCD", []byte{0x43, 0x66, 0x00, 0x00}, modbusIface.TypeFloat32, modbusIface.OrderABCD, 230},
+		{"float32 CDAB", []byte{0x00, 0x00, 0x43, 0x66}, modbusIface.TypeFloat32, modbusIface.OrderCDAB, 230},
+		{"float32 BADC", []byte{0x66, 0x43, 0x00, 0x00}, modbusIface.TypeFloat32, modbusIface.OrderBADC, 230},
+		{"float32 DCBA", []byte{0x00, 0x00, 0x66, 0x43}, modbusIface.TypeFloat32, modbusIface.OrderDCBA, 230},
+		{"int64", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF6}, modbusIface.TypeInt64, "", -10},
+		{"float64 CDAB", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x49}, modbusIface.TypeFloat64, modbusIface.OrderCDAB, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decode(tt.raw, modbusIface.RegisterParam{Type: tt.typ, Order: tt.order})
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_ShortResponse(t *testing.T) {
+	_, err := decode([]byte{0x00, 0x01}, modbusIface.RegisterParam{Type: modbusIface.TypeUint32})
+	if err == nil {
+		t.Fatal("expected error for short response")
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	orders := []modbusIface.ByteOrder{modbusIface.OrderABCD, modbusIface.OrderCDAB, modbusIface.OrderBADC, modbusIface.OrderDCBA}
+	types := []modbusIface.DataType{
+		modbusIface.TypeInt16, modbusIface.TypeUint16, modbusIface.TypeInt32, modbusIface.TypeUint32,
+		modbusIface.TypeFloat32, modbusIface.TypeInt64, modbusIface.TypeUint64, modbusIface.TypeFloat64,
+	}
+	for _, typ := range types {
+		for _, order := range orders {
+			p := modbusIface.RegisterParam{Type: typ, Order: order}
+			raw, err := encode(1234, p)
+			if err != nil {
+				t.Fatalf("%s %s: encode: %v", typ, order, err)
+			}
+			got, err := decode(raw, p)
+			if err != nil || got != 1234 {
+				t.Fatalf("%s %s: got %v, %v", typ, order, got, err)
+			}
+		}
+	}
+}
+
+func TestEncode_OutOfRange(t *testing.T) {
+	if _, err := encode(-1, modbusIface.RegisterParam{Type: modbusIface.TypeUint16}); err == nil {
+		t.Fatal("expected range error for negative uint16")
+	}
+	if _, err := encode(40000, modbusIface.RegisterParam{Type: modbusIface.TypeInt16}); err == nil {
+		t.Fatal("expected range error for int16 overflow")
+	}
+	// 2^63 and 2^64 are the float64 values of MaxInt64 and MaxUint64
+	if _, err := encode(1<<63, modbusIface.RegisterParam{Type: modbusIface.TypeInt64}); err == nil {
+		t.Fatal("expected range error for 2^63 as int64")
+	}
+	if _, err := encode(1<<64, modbusIface.RegisterParam{Type: modbusIface.TypeUint64}); err == nil {
+		t.Fatal("expected range error for 2^64 as uint64")
+	}
+	if _, err := encode(math.MinInt64, modbusIface.RegisterParam{Type: modbusIface.TypeInt64}); err != nil {
+		t.Fatalf("MinInt64: %v", err)
+	}
+}
+
+func TestDecodeBit(t *testing.T) {
+	raw := []byte{0xF1, 0x04}
+	for n, want := range map[int]float64{0: 1, 1: 0, 3: 0, 4: 1, 8: 0, 10: 1, 15: 0} {
+		got, err := decodeBit(raw, n)
+		if err != nil || got != want {
+			t.Errorf("bit %d: got %v, %v, want %v", n, got, err, want)
+		}
+	}
+	if _, err := decodeBit(raw, 16); err == nil {
+		t.Error("expected error for short response")
+	}
+}
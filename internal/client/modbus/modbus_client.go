@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,99 +32,213 @@ type EnvCfg struct {
 	// TCP
 	TCPAddr string // "192.168.1.10:502"
 
-	IntervalSec int
-	MapCfg      RegMap
-}
+	// Batching
+	MaxGap   int // unused registers allowed between merged points
+	MaxBlock int // registers per request, at most 125
+
+	// Reconnect
+	ReconnectAfter int // consecutive transport errors before the transport is reopened
+	BackoffMinMs   int
+	BackoffMaxMs   int
 
-type RegMap struct {
-	// Input/holding address and scaling for each metric
-	Frequency struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"` // raw / scale
-		Holding bool    `json:"holding"`
-	} `json:"frequency"`
-	Voltage struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"voltage"`
-	Power struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"power"`
-	Energy struct {
-		Addr    uint16  `json:"addr"`
-		Scale   float64 `json:"scale"`
-		Holding bool    `json:"holding"`
-	} `json:"energy"`
+	IntervalSec int
+	MapCfg      modbusIface.RegMap
 }
 
 type handler struct {
 	modbusIface.API
 	context.Context
-	closeFn func() error
+	mu       sync.Mutex // serializes access to the shared bus
+	connect  func() error
+	closeFn  func() error
+	setSlave func(id byte)
+	slave    byte
+	maxGap   uint16
+	maxBlock uint16
+
+	// reconnect state, guarded by mu
+	closed         bool
+	connected      bool
+	errStreak      int          // consecutive transport errors
+	timeouts       map[byte]int // consecutive timeouts per slave
+	attempts       int
+	retryAt        time.Time
+	reconnectAfter int
+	backoffMin     time.Duration
+	backoffMax     time.Duration
 }
 
+// NewHandler opens the configured RTU or TCP transport. A failing initial
+// connect is not fatal: the handler starts disconnected and keeps retrying
+// with backoff on every request.
 func NewHandler() (modbusIface.Client, error) {
 	cfg, err := LoadEnvCfg()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
+	h := &handler{
+		Context:        context.Background(),
+		slave:          byte(cfg.SlaveID),
+		maxGap:         uint16(cfg.MaxGap),
+		maxBlock:       uint16(cfg.MaxBlock),
+		reconnectAfter: cfg.ReconnectAfter,
+		backoffMin:     time.Duration(cfg.BackoffMinMs) * time.Millisecond,
+		backoffMax:     time.Duration(cfg.BackoffMaxMs) * time.Millisecond,
+	}
 
 	if cfg.Mode == "tcp" {
 		th := modbus.NewTCPClientHandler(cfg.TCPAddr)
 		th.Timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
-		if err := th.Connect(); err != nil {
-			return nil, err
-		}
-		return &handler{
-			API:     modbus.NewClient(th),
-			Context: ctx,
-			closeFn: th.Close,
-		}, nil
+		h.API = modbus.NewClient(th)
+		h.connect = th.Connect
+		h.closeFn = th.Close
+		h.setSlave = func(id byte) { th.SlaveId = id }
+	} else {
+		rh := modbus.NewRTUClientHandler(cfg.Port)
+		rh.BaudRate = cfg.Baud
+		rh.DataBits = cfg.DataBits
+		rh.Parity = cfg.Parity
+		rh.StopBits = cfg.StopBits
+		rh.SlaveId = byte(cfg.SlaveID)
+		rh.Timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+		h.API = modbus.NewClient(rh)
+		h.connect = rh.Connect
+		h.closeFn = rh.Close
+		h.setSlave = func(id byte) { rh.SlaveId = id }
 	}
 
-	rh := modbus.NewRTUClientHandler(cfg.Port)
-	rh.BaudRate = cfg.Baud
-	rh.DataBits = cfg.DataBits
-	rh.Parity = cfg.Parity
-	rh.StopBits = cfg.StopBits
-	rh.SlaveId = byte(cfg.SlaveID)
-	rh.Timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
-	if err := rh.Connect(); err != nil {
-		return nil, err
+	h.mu.Lock()
+	_ = h.ensureConnected()
+	h.mu.Unlock()
+	return h, nil
+}
+
+func (h *handler) ReadFloat(param modbusIface.RegisterParam) (float64, error) {
+	r := h.ReadBatch([]modbusIface.RegisterParam{param})[0]
+	return r.Value, r.Err
+}
+
+func (h *handler) ReadBatch(params []modbusIface.RegisterParam) []modbusIface.Reading {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	readings := make([]modbusIface.Reading, len(params))
+	for i, p := range params {
+		if p.Registers() == 0 {
+			readings[i].Err = fmt.Errorf("unsupported data type %q", p.Type)
+		}
 	}
 
-	return &handler{
-		API:     modbus.NewClient(rh),
-		Context: ctx,
-		closeFn: rh.Close,
-	}, nil
+	for _, b := range planBlocks(params, h.maxGap, h.maxBlock) {
+		res, err := h.readBlock(b)
+		for _, i := range b.items {
+			if err != nil {
+				readings[i].Err = err
+				continue
+			}
+			if b.function.IsBit() {
+				readings[i].Value, readings[i].Err = decodeBit(res, int(params[i].Addr-b.start))
+				continue
+			}
+			off := min(2*int(params[i].Addr-b.start), len(res))
+			v, err := decode(res[off:], params[i])
+			if err != nil {
+				readings[i].Err = err
+				continue
+			}
+			readings[i].Value = v / params[i].Scale
+		}
+	}
+	return readings
 }
 
-func (h *handler) ReadFloat(param modbusIface.RegisterParam) (float64, error) {
-	var res []byte
-	var err error
-	if param.Holding {
-		res, err = h.API.ReadHoldingRegisters(param.Addr, 1)
-	} else {
-		res, err = h.API.ReadInputRegisters(param.Addr, 1)
+func (h *handler) WriteValue(param modbusIface.RegisterParam, value float64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch param.Function {
+	case modbusIface.FuncCoil:
+		if err := h.ensureConnected(); err != nil {
+			return err
+		}
+		slave := h.selectSlave(param.Slave)
+		var v uint16
+		if value != 0 {
+			v = 0xFF00
+		}
+		start := time.Now()
+		_, err := h.API.WriteSingleCoil(param.Addr, v)
+		h.record(slave, param.Function, "write", start, err)
+		return err
+	case modbusIface.FuncHolding:
+	default:
+		return fmt.Errorf("function %q is not writable", param.Function)
 	}
+	raw, err := encode(value*param.Scale, param)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if err := h.ensureConnected(); err != nil {
+		return err
+	}
+	slave := h.selectSlave(param.Slave)
+
+	start := time.Now()
+	if len(raw) == 2 {
+		_, err = h.API.WriteSingleRegister(param.Addr, uint16(raw[0])<<8|uint16(raw[1]))
+	} else {
+		_, err = h.API.WriteMultipleRegisters(param.Addr, uint16(len(raw)/2), raw)
+	}
+	h.record(slave, param.Function, "write", start, err)
+	return err
+}
+
+// selectSlave addresses the next request and returns the slave used.
+func (h *handler) selectSlave(slave byte) byte {
+	if slave == 0 {
+		slave = h.slave
+	}
+	h.setSlave(slave)
+	return slave
+}
+
+func (h *handler) readBlock(b block) ([]byte, error) {
+	if err := h.ensureConnected(); err != nil {
+		return nil, err
 	}
-	// 16-bit register
-	if len(res) < 2 {
-		return 0, fmt.Errorf("short response")
+	slave := h.selectSlave(b.slave)
+
+	var res []byte
+	var err error
+	start := time.Now()
+	switch b.function {
+	case modbusIface.FuncCoil:
+		res, err = h.API.ReadCoils(b.start, b.count)
+	case modbusIface.FuncDiscrete:
+		res, err = h.API.ReadDiscreteInputs(b.start, b.count)
+	case modbusIface.FuncInput:
+		res, err = h.API.ReadInputRegisters(b.start, b.count)
+	default:
+		res, err = h.API.ReadHoldingRegisters(b.start, b.count)
 	}
-	raw := uint16(res[0])<<8 | uint16(res[1])
-	return float64(int16(raw)) / param.Scale, nil
+	h.record(slave, b.function, "read", start, err)
+	return res, err
 }
 
-func (h *handler) Close() error { return nil }
+func (h *handler) Connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connected
+}
+
+func (h *handler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	h.connected = false
+	return h.closeFn()
+}
 
 func LoadEnvCfg() (EnvCfg, error) {
 	var c EnvCfg
@@ -147,9 +262,16 @@ func LoadEnvCfg() (EnvCfg, error) {
 		c.DataBits, _ = strconv.Atoi(getEnvDefault("MODBUS_DATABITS", "8"))
 		c.Parity = getEnvDefault("MODBUS_PARITY", "N")
 		c.StopBits, _ = strconv.Atoi(getEnvDefault("MODBUS_STOPBITS", "1"))
-		c.SlaveID, _ = strconv.Atoi(getEnvDefault("MODBUS_SLAVE_ID", "1"))
-		c.TimeoutMs, _ = strconv.Atoi(getEnvDefault("MODBUS_TIMEOUT_MS", "500"))
 	}
+	c.SlaveID, _ = strconv.Atoi(getEnvDefault("MODBUS_SLAVE_ID", "1"))
+	c.TimeoutMs, _ = strconv.Atoi(getEnvDefault("MODBUS_TIMEOUT_MS", "500"))
+
+	c.MaxGap, _ = strconv.Atoi(getEnvDefault("MODBUS_MAX_GAP", "0"))
+	c.MaxBlock, _ = strconv.Atoi(getEnvDefault("MODBUS_MAX_BLOCK", "125"))
+
+	c.ReconnectAfter, _ = strconv.Atoi(getEnvDefault("MODBUS_RECONNECT_AFTER", "3"))
+	c.BackoffMinMs, _ = strconv.Atoi(getEnvDefault("MODBUS_BACKOFF_MIN_MS", "500"))
+	c.BackoffMaxMs, _ = strconv.Atoi(getEnvDefault("MODBUS_BACKOFF_MAX_MS", "30000"))
 
 	c.IntervalSec, _ = strconv.Atoi(getEnvDefault("INTERVAL_SEC", "1"))
 	c.DeviceID = getEnvDefault("DEVICE_ID", "unknown")
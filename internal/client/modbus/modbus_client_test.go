@@ -0,0 +1,60 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+)
+
+func newTestHandler(api modbusIface.API) *handler {
+	return &handler{
+		API:            api,
+		connect:        func() error { return nil },
+		closeFn:        func() error { return nil },
+		setSlave:       func(byte) {},
+		connected:      true,
+		maxGap:         16,
+		reconnectAfter: 3,
+		backoffMin:     time.Hour,
+		backoffMax:     time.Hour,
+	}
+}
+
+func TestReadBatch_Coils(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	api := mock.NewMockAPI(ctrl)
+	// coils 0x10..0x22 in one request, packed LSB first into three bytes
+	api.EXPECT().ReadCoils(uint16(0x10), uint16(19)).Return([]byte{0xF1, 0x04, 0x04}, nil)
+
+	coil := func(addr uint16) modbusIface.RegisterParam {
+		return modbusIface.RegisterParam{Addr: addr, Function: modbusIface.FuncCoil, Scale: 1}
+	}
+	params := []modbusIface.RegisterParam{coil(0x22), coil(0x10), coil(0x13), coil(0x1A), coil(0x1B)}
+	want := []float64{1, 1, 0, 1, 0}
+
+	for i, r := range newTestHandler(api).ReadBatch(params) {
+		if r.Err != nil || r.Value != want[i] {
+			t.Errorf("coil %#x: got %v, %v, want %v", params[i].Addr, r.Value, r.Err, want[i])
+		}
+	}
+}
+
+func TestWriteValue_Coil(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	api := mock.NewMockAPI(ctrl)
+	gomock.InOrder(
+		api.EXPECT().WriteSingleCoil(uint16(0x05), uint16(0xFF00)).Return(nil, nil),
+		api.EXPECT().WriteSingleCoil(uint16(0x05), uint16(0x0000)).Return(nil, nil),
+	)
+
+	h := newTestHandler(api)
+	param := modbusIface.RegisterParam{Addr: 0x05, Function: modbusIface.FuncCoil}
+	for _, v := range []float64{1, 0} {
+		if err := h.WriteValue(param, v); err != nil {
+			t.Fatalf("write %v: %v", v, err)
+		}
+	}
+}
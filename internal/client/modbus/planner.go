@@ -0,0 +1,77 @@
+package modbus
+
+import (
+	"sort"
+
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+// Protocol limits for FC03/FC04 and FC01/FC02 responses.
+const (
+	maxReadRegisters = 125
+	maxReadBits      = 2000
+)
+
+// block is a single read request covering one or more params.
+type block struct {
+	slave    byte
+	function modbusIface.Function
+	start    uint16
+	count    uint16
+	items    []int // indexes into the planned params
+}
+
+// planBlocks groups params by slave and function and merges params whose
+// addresses are at most maxGap registers apart into blocks of at most
+// maxSize registers. Coils and discrete inputs are merged up to the bit
+// limit instead. Params with an unknown data type are left out.
+func planBlocks(params []modbusIface.RegisterParam, maxGap, maxSize uint16) []block {
+	if maxSize == 0 || maxSize > maxReadRegisters {
+		maxSize = maxReadRegisters
+	}
+
+	idx := make([]int, 0, len(params))
+	for i, p := range params {
+		if p.Registers() > 0 {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		pa, pb := params[idx[a]], params[idx[b]]
+		if pa.Slave != pb.Slave {
+			return pa.Slave < pb.Slave
+		}
+		if pa.Function != pb.Function {
+			return pa.Function < pb.Function
+		}
+		return pa.Addr < pb.Addr
+	})
+
+	var blocks []block
+	for _, i := range idx {
+		p := params[i]
+		end := uint32(p.Addr) + uint32(p.Registers())
+		if n := len(blocks); n > 0 && blocks[n-1].slave == p.Slave && blocks[n-1].function == p.Function {
+			cur := &blocks[n-1]
+			curEnd := uint32(cur.start) + uint32(cur.count)
+			newEnd := max(curEnd, end)
+			limit := uint32(maxSize)
+			if p.Function.IsBit() {
+				limit = maxReadBits
+			}
+			if uint32(p.Addr) <= curEnd+uint32(maxGap) && newEnd-uint32(cur.start) <= limit {
+				cur.count = uint16(newEnd - uint32(cur.start))
+				cur.items = append(cur.items, i)
+				continue
+			}
+		}
+		blocks = append(blocks, block{
+			slave:    p.Slave,
+			function: p.Function,
+			start:    p.Addr,
+			count:    p.Registers(),
+			items:    []int{i},
+		})
+	}
+	return blocks
+}
@@ -0,0 +1,69 @@
+package modbus
+
+import (
+	"reflect"
+	"testing"
+
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+)
+
+func TestPlanBlocks(t *testing.T) {
+	holding := func(addr uint16, typ modbusIface.DataType) modbusIface.RegisterParam {
+		return modbusIface.RegisterParam{Addr: addr, Function: modbusIface.FuncHolding, Type: typ}
+	}
+	params := []modbusIface.RegisterParam{
+		holding(0x2004, modbusIface.TypeUint32),
+		holding(0x2000, modbusIface.TypeInt16),
+		holding(0x2001, modbusIface.TypeInt16),
+		{Addr: 0x2002, Function: modbusIface.FuncInput, Type: modbusIface.TypeInt16},
+		holding(0x3000, modbusIface.TypeInt16),
+		holding(0x2010, "bogus"),
+	}
+
+	got := planBlocks(params, 2, 125)
+	want := []block{
+		{function: modbusIface.FuncHolding, start: 0x2000, count: 6, items: []int{1, 2, 0}},
+		{function: modbusIface.FuncHolding, start: 0x3000, count: 1, items: []int{4}},
+		{function: modbusIface.FuncInput, start: 0x2002, count: 1, items: []int{3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPlanBlocks_SplitsOnGapAndSize(t *testing.T) {
+	params := []modbusIface.RegisterParam{
+		{Addr: 0, Type: modbusIface.TypeInt16},
+		{Addr: 2, Type: modbusIface.TypeInt16},
+		{Addr: 3, Type: modbusIface.TypeFloat64},
+		{Addr: 1, Slave: 2, Type: modbusIface.TypeInt16},
+	}
+
+	got := planBlocks(params, 0, 4)
+	want := []block{
+		{start: 0, count: 1, items: []int{0}},
+		{start: 2, count: 1, items: []int{1}},
+		{start: 3, count: 4, items: []int{2}},
+		{slave: 2, start: 1, count: 1, items: []int{3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPlanBlocks_Bits(t *testing.T) {
+	params := []modbusIface.RegisterParam{
+		{Addr: 0, Function: modbusIface.FuncCoil},
+		{Addr: 1500, Function: modbusIface.FuncCoil},
+		{Addr: 0, Function: modbusIface.FuncDiscrete},
+	}
+
+	got := planBlocks(params, 2000, 125)
+	want := []block{
+		{function: modbusIface.FuncCoil, start: 0, count: 1501, items: []int{0, 1}},
+		{function: modbusIface.FuncDiscrete, start: 0, count: 1, items: []int{2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
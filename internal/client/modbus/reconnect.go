@@ -0,0 +1,120 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+	"github.com/tetragramaton/smh-go/internal/metrics"
+)
+
+// ErrDisconnected is returned while the transport is down and the next
+// reconnect attempt is not due yet.
+var ErrDisconnected = errors.New("modbus: transport disconnected")
+
+// ErrClosed is returned for requests made after Close.
+var ErrClosed = errors.New("modbus: client closed")
+
+// ensureConnected reopens the transport if it is down and the backoff has
+// elapsed. Callers must hold h.mu.
+func (h *handler) ensureConnected() error {
+	if h.closed {
+		return ErrClosed
+	}
+	if h.connected {
+		return nil
+	}
+	if time.Now().Before(h.retryAt) {
+		return ErrDisconnected
+	}
+	if err := h.connect(); err != nil {
+		metrics.ModbusReconnects.WithLabelValues("failed").Inc()
+		h.attempts++
+		h.retryAt = time.Now().Add(h.backoff(h.attempts))
+		return fmt.Errorf("modbus: reconnect: %w", err)
+	}
+	metrics.ModbusReconnects.WithLabelValues("ok").Inc()
+	h.connected = true
+	h.attempts = 0
+	h.errStreak = 0
+	clear(h.timeouts)
+	return nil
+}
+
+// record tracks the outcome of a bus request started at start and closes
+// the transport after reconnectAfter consecutive transport failures. Modbus
+// exceptions come from a responding device and do not count. Timeouts are
+// counted per slave: one unpowered slave on a shared bus must not take the
+// others offline, so they only count once every slave stopped answering.
+// Callers must hold h.mu.
+func (h *handler) record(slave byte, fn modbusIface.Function, op string, start time.Time, err error) {
+	labels := []string{strconv.Itoa(int(slave)), string(fn), op}
+	metrics.ModbusRequests.WithLabelValues(labels...).Inc()
+	metrics.ModbusLatency.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	kind := ""
+	if err != nil {
+		kind = errorKind(err)
+		metrics.ModbusErrors.WithLabelValues(append(labels, kind)...).Inc()
+	}
+	if h.timeouts == nil {
+		h.timeouts = map[byte]int{}
+	}
+
+	limit := max(h.reconnectAfter, 1)
+	switch kind {
+	case "", "exception":
+		h.errStreak = 0
+		h.timeouts[slave] = 0
+		return
+	case "timeout":
+		h.timeouts[slave]++
+		for _, n := range h.timeouts {
+			if n < limit {
+				return
+			}
+		}
+	default:
+		h.errStreak++
+		if h.errStreak < limit {
+			return
+		}
+	}
+	_ = h.closeFn()
+	h.connected = false
+	h.errStreak = 0
+	clear(h.timeouts)
+	h.retryAt = time.Now().Add(h.backoff(0))
+}
+
+// errorKind classifies a failed request for metrics.
+func errorKind(err error) string {
+	var mbErr *modbus.ModbusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &mbErr):
+		return "exception"
+	case errors.Is(err, serial.ErrTimeout), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "transport"
+}
+
+// backoff returns the delay before reconnect attempt n: exponential from
+// backoffMin up to backoffMax, with the upper half randomized.
+func (h *handler) backoff(n int) time.Duration {
+	d := h.backoffMin
+	for i := 0; i < n && d < h.backoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, h.backoffMax)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
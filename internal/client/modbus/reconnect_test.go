@@ -0,0 +1,134 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+	"github.com/golang/mock/gomock"
+	modbusIface "github.com/tetragramaton/smh-go/internal/interface/modbus"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus/mock"
+)
+
+func TestHandler_ReconnectsAfterTransportFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	api := mock.NewMockAPI(ctrl)
+
+	var connects, closes int
+	h := &handler{
+		API:            api,
+		connect:        func() error { connects++; return nil },
+		closeFn:        func() error { closes++; return nil },
+		setSlave:       func(byte) {},
+		connected:      true,
+		reconnectAfter: 2,
+		backoffMin:     time.Hour,
+		backoffMax:     time.Hour,
+	}
+	param := modbusIface.RegisterParam{Addr: 1, Function: modbusIface.FuncHolding, Type: modbusIface.TypeInt16, Scale: 1}
+	ioErr := errors.New("read /dev/ttyUSB0: input/output error")
+
+	// an exception from a live device does not count as a transport failure
+	api.EXPECT().ReadHoldingRegisters(uint16(1), uint16(1)).Return(nil, &modbus.ModbusError{ExceptionCode: 2})
+	api.EXPECT().ReadHoldingRegisters(uint16(1), uint16(1)).Return(nil, ioErr).Times(2)
+	for i := 0; i < 3; i++ {
+		_, _ = h.ReadFloat(param)
+	}
+	if h.Connected() || closes != 1 {
+		t.Fatalf("expected transport to be closed once, connected=%v closes=%d", h.Connected(), closes)
+	}
+
+	// backoff pending: no bus traffic
+	if _, err := h.ReadFloat(param); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got %v", err)
+	}
+
+	// backoff elapsed: reopen and read
+	h.retryAt = time.Now()
+	api.EXPECT().ReadHoldingRegisters(uint16(1), uint16(1)).Return([]byte{0, 42}, nil)
+	v, err := h.ReadFloat(param)
+	if err != nil || v != 42 || connects != 1 || !h.Connected() {
+		t.Fatalf("got %v, %v after reconnect (connects=%d)", v, err, connects)
+	}
+}
+
+func TestHandler_TimeoutsArePerSlave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	api := mock.NewMockAPI(ctrl)
+
+	var closes int
+	var slave byte
+	silent := false
+	h := &handler{
+		API:            api,
+		connect:        func() error { return nil },
+		closeFn:        func() error { closes++; return nil },
+		setSlave:       func(id byte) { slave = id },
+		connected:      true,
+		reconnectAfter: 3,
+		backoffMin:     time.Hour,
+		backoffMax:     time.Hour,
+	}
+	timeout := fmt.Errorf("read: %w", serial.ErrTimeout)
+	api.EXPECT().ReadHoldingRegisters(uint16(1), uint16(1)).DoAndReturn(func(uint16, uint16) ([]byte, error) {
+		if slave == 2 || silent {
+			return nil, timeout
+		}
+		return []byte{0, 7}, nil
+	}).AnyTimes()
+
+	params := []modbusIface.RegisterParam{
+		{Slave: 1, Addr: 1, Function: modbusIface.FuncHolding, Type: modbusIface.TypeInt16, Scale: 1},
+		{Slave: 2, Addr: 1, Function: modbusIface.FuncHolding, Type: modbusIface.TypeInt16, Scale: 1},
+	}
+	for poll := 0; poll < 10; poll++ {
+		r := h.ReadBatch(params)
+		if r[0].Err != nil || r[0].Value != 7 {
+			t.Fatalf("poll %d: slave 1 got %v, %v", poll, r[0].Value, r[0].Err)
+		}
+		if !errors.Is(r[1].Err, serial.ErrTimeout) {
+			t.Fatalf("poll %d: slave 2 got %v", poll, r[1].Err)
+		}
+	}
+	if !h.Connected() || closes != 0 {
+		t.Fatalf("one silent slave closed the transport: connected=%v closes=%d", h.Connected(), closes)
+	}
+
+	// the whole bus silent, e.g. a TCP gateway that stopped answering
+	silent = true
+	for i := 0; i < 3; i++ {
+		_, _ = h.ReadFloat(params[0])
+	}
+	if h.Connected() || closes != 1 {
+		t.Fatalf("silent bus: connected=%v closes=%d", h.Connected(), closes)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	h := &handler{backoffMin: 100 * time.Millisecond, backoffMax: time.Second}
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		d := h.backoff(n)
+		if d < want/2 || d > want {
+			t.Errorf("backoff(%d) = %v, want in [%v, %v]", n, d, want/2, want)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	cases := map[error]string{
+		&modbus.ModbusError{FunctionCode: 3, ExceptionCode: 2}: "exception",
+		fmt.Errorf("read: %w", serial.ErrTimeout):              "timeout",
+		&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}:  "timeout",
+		errors.New("broken pipe"):                              "transport",
+	}
+	for err, want := range cases {
+		if got := errorKind(err); got != want {
+			t.Errorf("%v: got %s, want %s", err, got, want)
+		}
+	}
+}
@@ -3,11 +3,15 @@ package mqtt
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+	"github.com/tetragramaton/smh-go/internal/metrics"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -16,16 +20,36 @@ import (
 type mqttClient struct {
 	mqttIface.API
 	context.Context
+	statusTopic string
+
+	mu          sync.Mutex
+	connects    int
+	subs        map[string]mqttIface.Subscription // restored on reconnect
+	onReconnect []func()
 }
 
 type Config struct {
-	BrokerURL string
-	ClientID  string
-	Username  string
-	Password  string
-	TLS       bool
+	BrokerURL   string
+	ClientID    string
+	Username    string
+	Password    string
+	TLS         bool
+	StatusTopic string // retained online/offline, also the Last Will topic
+
+	// TLS settings; server certificates are verified unless TLSInsecure is set.
+	TLSCAFile     string
+	TLSCertFile   string // client certificate for mutual TLS
+	TLSKeyFile    string
+	TLSServerName string // overrides the host name used for verification
+	TLSMinVersion string // "1.2" if empty
+	TLSInsecure   bool
 }
 
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
 func LoadConfigFromEnv() (Config, error) {
 	var cfg Config
 
@@ -37,6 +61,10 @@ func LoadConfigFromEnv() (Config, error) {
 	if cfg.ClientID == "" {
 		return cfg, errors.New("missing MQTT_CLIENT_ID")
 	}
+	cfg.StatusTopic = os.Getenv("MQTT_STATUS_TOPIC")
+	if cfg.StatusTopic == "" {
+		cfg.StatusTopic = "smh/" + cfg.ClientID + "/status"
+	}
 	cfg.Username = os.Getenv("MQTT_USERNAME")
 	cfg.Password = os.Getenv("MQTT_PASSWORD")
 
@@ -47,60 +75,190 @@ func LoadConfigFromEnv() (Config, error) {
 		}
 		cfg.TLS = b
 	}
+	cfg.TLSCAFile = os.Getenv("MQTT_TLS_CA_FILE")
+	cfg.TLSCertFile = os.Getenv("MQTT_TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("MQTT_TLS_KEY_FILE")
+	cfg.TLSServerName = os.Getenv("MQTT_TLS_SERVER_NAME")
+	cfg.TLSMinVersion = os.Getenv("MQTT_TLS_MIN_VERSION")
+	if v := os.Getenv("MQTT_TLS_INSECURE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MQTT_TLS_INSECURE %q: %w", v, err)
+		}
+		cfg.TLSInsecure = b
+	}
 
 	return cfg, nil
 }
 
+func isTLSURL(u string) bool {
+	for _, scheme := range []string{"ssl://", "tls://", "mqtts://", "tcps://", "wss://"} {
+		if strings.HasPrefix(u, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsConfig builds the client TLS configuration from cfg.
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+
+	switch cfg.TLSMinVersion {
+	case "", "1.2":
+		tc.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tc.MinVersion = tls.VersionTLS13
+	case "1.1":
+		tc.MinVersion = tls.VersionTLS11
+	case "1.0":
+		tc.MinVersion = tls.VersionTLS10
+	default:
+		return nil, fmt.Errorf("invalid MQTT_TLS_MIN_VERSION %q", cfg.TLSMinVersion)
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("MQTT_TLS_CERT_FILE and MQTT_TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
+
 func NewClient() (mqttIface.Client, error) {
 	cfg, err := LoadConfigFromEnv()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
+	c := &mqttClient{
+		Context:     context.Background(),
+		statusTopic: cfg.StatusTopic,
+		subs:        map[string]mqttIface.Subscription{},
+	}
 
 	opts := mqtt.NewClientOptions().
 		AddBroker(cfg.BrokerURL).
 		SetClientID(cfg.ClientID).
-		SetKeepAlive(30 * time.Second).
-		SetConnectTimeout(5 * time.Second).
-		SetPingTimeout(3 * time.Second).
-		SetOrderMatters(false)
+		SetKeepAlive(30*time.Second).
+		SetConnectTimeout(5*time.Second).
+		SetPingTimeout(3*time.Second).
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetWill(cfg.StatusTopic, StatusOffline, 1, true).
+		SetOnConnectHandler(c.onConnect)
 
 	if cfg.Username != "" {
 		opts.SetUsername(cfg.Username)
 		opts.SetPassword(cfg.Password)
 	}
-	if cfg.TLS {
-		opts.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	if cfg.TLS || isTLSURL(cfg.BrokerURL) {
+		tc, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tc)
 	}
 
 	client := mqtt.NewClient(opts)
+	c.API = client
 	t := client.Connect()
-	if ok := t.WaitTimeout(10 * time.Second); !ok || t.Error() != nil {
+	if ok := t.WaitTimeout(10 * time.Second); !ok {
+		return nil, errors.New("mqtt connect timeout")
+	}
+	if t.Error() != nil {
 		return nil, t.Error()
 	}
-	return &mqttClient{
-		API:     client,
-		Context: ctx,
-	}, nil
+	return c, nil
 }
 
-func (c mqttClient) PublishEvent(message mqttIface.Message) error {
+// onConnect runs on every (re)connect: it replaces a previously fired will,
+// restores subscriptions lost with a clean session and, after a reconnect,
+// notifies the OnReconnect listeners.
+func (c *mqttClient) onConnect(cl mqtt.Client) {
+	cl.Publish(c.statusTopic, 1, true, StatusOnline)
+
+	c.mu.Lock()
+	c.connects++
+	reconnect := c.connects > 1
+	subs := make([]mqttIface.Subscription, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	listeners := append([]func(){}, c.onReconnect...)
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		cl.Subscribe(s.Topic, s.QoS, s.Callback).Wait()
+	}
+	if reconnect {
+		for _, fn := range listeners {
+			fn()
+		}
+	}
+}
+
+func (c *mqttClient) PublishEvent(message mqttIface.Message) error {
+	start := time.Now()
 	t := c.API.Publish(message.Topic, message.QoS, message.Retain, message.Payload)
 	t.Wait()
-	return t.Error()
+	metrics.MQTTPublishLatency.Observe(time.Since(start).Seconds())
+	if err := t.Error(); err != nil {
+		metrics.MQTTPublishFailures.Inc()
+		return err
+	}
+	return nil
 }
 
-func (c mqttClient) SubscribeToTopic(sub mqttIface.Subscription) error {
+func (c *mqttClient) SubscribeToTopic(sub mqttIface.Subscription) error {
+	c.mu.Lock()
+	c.subs[sub.Topic] = sub
+	c.mu.Unlock()
+
 	t := c.API.Subscribe(sub.Topic, sub.QoS, sub.Callback)
 	t.Wait()
 	return t.Error()
 }
 
-func (c mqttClient) Close(quiesce uint) error {
-	if c.IsConnectionOpen() {
-		c.Disconnect(quiesce)
+func (c *mqttClient) OnReconnect(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReconnect = append(c.onReconnect, fn)
+}
+
+func (c *mqttClient) StatusTopic() string {
+	return c.statusTopic
+}
+
+// Close publishes offline on the status topic, since a clean disconnect
+// does not trigger the Last Will, and disconnects.
+func (c *mqttClient) Close(quiesce uint) error {
+	if !c.IsConnectionOpen() {
+		return nil
 	}
-	return nil
+	t := c.API.Publish(c.statusTopic, 1, true, StatusOffline)
+	t.WaitTimeout(time.Second)
+	c.Disconnect(quiesce)
+	return t.Error()
 }
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mqttIface "github.com/tetragramaton/smh-go/internal/interface/mqtt"
+)
+
+func TestTLSConfig_VerifiesByDefault(t *testing.T) {
+	tc, err := tlsConfig(Config{TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.InsecureSkipVerify {
+		t.Fatal("verification must be on by default")
+	}
+	if tc.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("unexpected min version %x", tc.MinVersion)
+	}
+}
+
+func TestTLSConfig_Files(t *testing.T) {
+	certFile, keyFile := writeSelfSigned(t)
+
+	tc, err := tlsConfig(Config{
+		TLSCAFile:     certFile,
+		TLSCertFile:   certFile,
+		TLSKeyFile:    keyFile,
+		TLSServerName: "broker.local",
+		TLSMinVersion: "1.3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.RootCAs == nil || len(tc.Certificates) != 1 || tc.ServerName != "broker.local" || tc.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected config %+v", tc)
+	}
+}
+
+func TestTLSConfig_Errors(t *testing.T) {
+	certFile, _ := writeSelfSigned(t)
+	for name, cfg := range map[string]Config{
+		"bad version":      {TLSMinVersion: "1.4"},
+		"cert without key": {TLSCertFile: certFile},
+		"missing CA":       {TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := tlsConfig(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func writeSelfSigned(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "broker.local"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// fakeBroker records what onConnect publishes and subscribes. Other
+// mqtt.Client methods are not used and panic.
+type fakeBroker struct {
+	mqtt.Client
+	published  []string
+	subscribed []string
+}
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{}          { ch := make(chan struct{}); close(ch); return ch }
+func (doneToken) Error() error                   { return nil }
+
+func (f *fakeBroker) Publish(topic string, _ byte, _ bool, payload interface{}) mqtt.Token {
+	f.published = append(f.published, topic+"="+payload.(string))
+	return doneToken{}
+}
+
+func (f *fakeBroker) Subscribe(topic string, _ byte, _ mqtt.MessageHandler) mqtt.Token {
+	f.subscribed = append(f.subscribed, topic)
+	return doneToken{}
+}
+
+func TestOnConnect_RestoresSubscriptionsOnReconnect(t *testing.T) {
+	broker := &fakeBroker{}
+	c := &mqttClient{statusTopic: "smh/adapter/status", subs: map[string]mqttIface.Subscription{}}
+	c.API = broker
+	fired := 0
+	c.OnReconnect(func() { fired++ })
+
+	// first connect: subscriptions are made by SubscribeToTopic afterwards
+	c.onConnect(broker)
+	if fired != 0 || len(broker.subscribed) != 0 {
+		t.Fatalf("first connect: fired %d, subscribed %v", fired, broker.subscribed)
+	}
+	if len(broker.published) != 1 || broker.published[0] != "smh/adapter/status=online" {
+		t.Fatalf("first connect published %v", broker.published)
+	}
+
+	for _, topic := range []string{"smh/dev/set/+", "smh/dev/request"} {
+		if err := c.SubscribeToTopic(mqttIface.Subscription{Topic: topic, QoS: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broker.subscribed = nil
+
+	c.onConnect(broker)
+	sort.Strings(broker.subscribed)
+	if want := []string{"smh/dev/request", "smh/dev/set/+"}; !slices.Equal(broker.subscribed, want) {
+		t.Errorf("reconnect subscribed %v, want %v", broker.subscribed, want)
+	}
+	if fired != 1 {
+		t.Errorf("reconnect fired listeners %d times, want 1", fired)
+	}
+	if n := len(broker.published); n != 2 || broker.published[1] != "smh/adapter/status=online" {
+		t.Errorf("reconnect published %v", broker.published)
+	}
+
+	c.onConnect(broker)
+	if fired != 2 {
+		t.Errorf("second reconnect fired listeners %d times, want 2", fired)
+	}
+}
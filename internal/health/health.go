@@ -0,0 +1,79 @@
+// Package health serves liveness and readiness reports and the shared HTTP
+// listener of the binaries.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Check is the outcome of one health check.
+type Check struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the body of /healthz and /readyz; OK only if every check is.
+type Report struct {
+	OK     bool             `json:"ok"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// NewReport returns an empty, healthy report.
+func NewReport() *Report {
+	return &Report{OK: true, Checks: map[string]Check{}}
+}
+
+// Add records a check.
+func (r *Report) Add(name string, ok bool, detail string) {
+	r.Checks[name] = Check{OK: ok, Detail: detail}
+	r.OK = r.OK && ok
+}
+
+// Handler serves the report built by fn as JSON, with status 200 when it
+// is OK and 503 otherwise.
+func Handler(fn func() *Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r := fn()
+		w.Header().Set("Content-Type", "application/json")
+		if !r.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(r)
+	})
+}
+
+// Addr returns the listen address of the HTTP endpoints: HTTP_ADDR, or the
+// older METRICS_ADDR. Empty disables the listener.
+func Addr() string {
+	if v := os.Getenv("HTTP_ADDR"); v != "" {
+		return v
+	}
+	return os.Getenv("METRICS_ADDR")
+}
+
+// Serve runs an HTTP server for mux on addr until ctx is cancelled. An empty
+// addr disables it.
+func Serve(ctx context.Context, addr string, mux *http.ServeMux) {
+	if addr == "" {
+		return
+	}
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("http listener", "addr", addr, "err", err)
+		}
+	}()
+	slog.Info("http endpoints up", "addr", addr)
+}
@@ -48,6 +48,64 @@ func (mr *MockClientMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockClient)(nil).Close))
 }
 
+// Connected mocks base method.
+func (m *MockClient) Connected() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Connected")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Connected indicates an expected call of Connected.
+func (mr *MockClientMockRecorder) Connected() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Connected", reflect.TypeOf((*MockClient)(nil).Connected))
+}
+
+// ReadBatch mocks base method.
+func (m *MockClient) ReadBatch(params []modbus.RegisterParam) []modbus.Reading {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadBatch", params)
+	ret0, _ := ret[0].([]modbus.Reading)
+	return ret0
+}
+
+// ReadBatch indicates an expected call of ReadBatch.
+func (mr *MockClientMockRecorder) ReadBatch(params interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadBatch", reflect.TypeOf((*MockClient)(nil).ReadBatch), params)
+}
+
+// ReadCoils mocks base method.
+func (m *MockClient) ReadCoils(address, quantity uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadCoils", address, quantity)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadCoils indicates an expected call of ReadCoils.
+func (mr *MockClientMockRecorder) ReadCoils(address, quantity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCoils", reflect.TypeOf((*MockClient)(nil).ReadCoils), address, quantity)
+}
+
+// ReadDiscreteInputs mocks base method.
+func (m *MockClient) ReadDiscreteInputs(address, quantity uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadDiscreteInputs", address, quantity)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDiscreteInputs indicates an expected call of ReadDiscreteInputs.
+func (mr *MockClientMockRecorder) ReadDiscreteInputs(address, quantity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDiscreteInputs", reflect.TypeOf((*MockClient)(nil).ReadDiscreteInputs), address, quantity)
+}
+
 // ReadFloat mocks base method.
 func (m *MockClient) ReadFloat(param modbus.RegisterParam) (float64, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +151,80 @@ func (mr *MockClientMockRecorder) ReadInputRegisters(address, quantity interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadInputRegisters", reflect.TypeOf((*MockClient)(nil).ReadInputRegisters), address, quantity)
 }
 
+// WriteMultipleCoils mocks base method.
+func (m *MockClient) WriteMultipleCoils(address, quantity uint16, value []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteMultipleCoils", address, quantity, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteMultipleCoils indicates an expected call of WriteMultipleCoils.
+func (mr *MockClientMockRecorder) WriteMultipleCoils(address, quantity, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteMultipleCoils", reflect.TypeOf((*MockClient)(nil).WriteMultipleCoils), address, quantity, value)
+}
+
+// WriteMultipleRegisters mocks base method.
+func (m *MockClient) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteMultipleRegisters", address, quantity, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteMultipleRegisters indicates an expected call of WriteMultipleRegisters.
+func (mr *MockClientMockRecorder) WriteMultipleRegisters(address, quantity, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteMultipleRegisters", reflect.TypeOf((*MockClient)(nil).WriteMultipleRegisters), address, quantity, value)
+}
+
+// WriteSingleCoil mocks base method.
+func (m *MockClient) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSingleCoil", address, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteSingleCoil indicates an expected call of WriteSingleCoil.
+func (mr *MockClientMockRecorder) WriteSingleCoil(address, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSingleCoil", reflect.TypeOf((*MockClient)(nil).WriteSingleCoil), address, value)
+}
+
+// WriteSingleRegister mocks base method.
+func (m *MockClient) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSingleRegister", address, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteSingleRegister indicates an expected call of WriteSingleRegister.
+func (mr *MockClientMockRecorder) WriteSingleRegister(address, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSingleRegister", reflect.TypeOf((*MockClient)(nil).WriteSingleRegister), address, value)
+}
+
+// WriteValue mocks base method.
+func (m *MockClient) WriteValue(param modbus.RegisterParam, value float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteValue", param, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteValue indicates an expected call of WriteValue.
+func (mr *MockClientMockRecorder) WriteValue(param, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteValue", reflect.TypeOf((*MockClient)(nil).WriteValue), param, value)
+}
+
 // MockAPI is a mock of API interface.
 type MockAPI struct {
 	ctrl     *gomock.Controller
@@ -116,6 +248,36 @@ func (m *MockAPI) EXPECT() *MockAPIMockRecorder {
 	return m.recorder
 }
 
+// ReadCoils mocks base method.
+func (m *MockAPI) ReadCoils(address, quantity uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadCoils", address, quantity)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadCoils indicates an expected call of ReadCoils.
+func (mr *MockAPIMockRecorder) ReadCoils(address, quantity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadCoils", reflect.TypeOf((*MockAPI)(nil).ReadCoils), address, quantity)
+}
+
+// ReadDiscreteInputs mocks base method.
+func (m *MockAPI) ReadDiscreteInputs(address, quantity uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadDiscreteInputs", address, quantity)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDiscreteInputs indicates an expected call of ReadDiscreteInputs.
+func (mr *MockAPIMockRecorder) ReadDiscreteInputs(address, quantity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDiscreteInputs", reflect.TypeOf((*MockAPI)(nil).ReadDiscreteInputs), address, quantity)
+}
+
 // ReadHoldingRegisters mocks base method.
 func (m *MockAPI) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -145,3 +307,63 @@ func (mr *MockAPIMockRecorder) ReadInputRegisters(address, quantity interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadInputRegisters", reflect.TypeOf((*MockAPI)(nil).ReadInputRegisters), address, quantity)
 }
+
+// WriteMultipleCoils mocks base method.
+func (m *MockAPI) WriteMultipleCoils(address, quantity uint16, value []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteMultipleCoils", address, quantity, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteMultipleCoils indicates an expected call of WriteMultipleCoils.
+func (mr *MockAPIMockRecorder) WriteMultipleCoils(address, quantity, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteMultipleCoils", reflect.TypeOf((*MockAPI)(nil).WriteMultipleCoils), address, quantity, value)
+}
+
+// WriteMultipleRegisters mocks base method.
+func (m *MockAPI) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteMultipleRegisters", address, quantity, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteMultipleRegisters indicates an expected call of WriteMultipleRegisters.
+func (mr *MockAPIMockRecorder) WriteMultipleRegisters(address, quantity, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteMultipleRegisters", reflect.TypeOf((*MockAPI)(nil).WriteMultipleRegisters), address, quantity, value)
+}
+
+// WriteSingleCoil mocks base method.
+func (m *MockAPI) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSingleCoil", address, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteSingleCoil indicates an expected call of WriteSingleCoil.
+func (mr *MockAPIMockRecorder) WriteSingleCoil(address, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSingleCoil", reflect.TypeOf((*MockAPI)(nil).WriteSingleCoil), address, value)
+}
+
+// WriteSingleRegister mocks base method.
+func (m *MockAPI) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSingleRegister", address, value)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteSingleRegister indicates an expected call of WriteSingleRegister.
+func (mr *MockAPIMockRecorder) WriteSingleRegister(address, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSingleRegister", reflect.TypeOf((*MockAPI)(nil).WriteSingleRegister), address, value)
+}
@@ -1,18 +1,232 @@
 package modbus
 
+import "math"
+
+// Function selects the Modbus table a point is read from.
+type Function string
+
+const (
+	FuncCoil     Function = "coil"     // FC01
+	FuncDiscrete Function = "discrete" // FC02
+	FuncHolding  Function = "holding"  // FC03
+	FuncInput    Function = "input"    // FC04
+)
+
+// IsBit reports whether the function reads single bits (coils and
+// discrete inputs) rather than 16-bit registers.
+func (f Function) IsBit() bool {
+	return f == FuncCoil || f == FuncDiscrete
+}
+
+// DataType is how the raw register words are interpreted.
+type DataType string
+
+const (
+	TypeInt16   DataType = "int16"
+	TypeUint16  DataType = "uint16"
+	TypeInt32   DataType = "int32"
+	TypeUint32  DataType = "uint32"
+	TypeFloat32 DataType = "float32"
+	TypeInt64   DataType = "int64"
+	TypeUint64  DataType = "uint64"
+	TypeFloat64 DataType = "float64"
+)
+
+// Registers returns the number of 16-bit registers the type spans,
+// or 0 for an unknown type.
+func (t DataType) Registers() uint16 {
+	switch t {
+	case TypeInt16, TypeUint16, "":
+		return 1
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 2
+	case TypeInt64, TypeUint64, TypeFloat64:
+		return 4
+	}
+	return 0
+}
+
+// Range returns the smallest and largest raw value of the type.
+func (t DataType) Range() (lo, hi float64) {
+	switch t {
+	case TypeUint16:
+		return 0, math.MaxUint16
+	case TypeInt32:
+		return math.MinInt32, math.MaxInt32
+	case TypeUint32:
+		return 0, math.MaxUint32
+	case TypeFloat32:
+		return -math.MaxFloat32, math.MaxFloat32
+	case TypeInt64:
+		return math.MinInt64, math.MaxInt64
+	case TypeUint64:
+		return 0, math.MaxUint64
+	case TypeFloat64:
+		return -math.MaxFloat64, math.MaxFloat64
+	}
+	return math.MinInt16, math.MaxInt16
+}
+
+// ByteOrder describes how the bytes of a multi-register value are laid out,
+// with A being the most significant byte.
+type ByteOrder string
+
+const (
+	OrderABCD ByteOrder = "ABCD" // big endian
+	OrderCDAB ByteOrder = "CDAB" // big endian bytes, swapped words
+	OrderBADC ByteOrder = "BADC" // swapped bytes, big endian words
+	OrderDCBA ByteOrder = "DCBA" // little endian
+)
+
 type RegisterParam struct {
-	Addr    uint16  `json:"addr"`
-	Scale   float64 `json:"scale"`
-	Holding bool    `json:"holding"`
+	Slave    byte      `json:"slave,omitempty"` // client default if zero
+	Addr     uint16    `json:"addr"`
+	Scale    float64   `json:"scale"`
+	Function Function  `json:"function"`
+	Type     DataType  `json:"type,omitempty"`  // int16 if empty
+	Count    uint16    `json:"count,omitempty"` // derived from Type if zero
+	Order    ByteOrder `json:"order,omitempty"` // ABCD if empty
+}
+
+// Registers returns the number of registers (or bits for coils and
+// discrete inputs) to read for the value.
+func (p RegisterParam) Registers() uint16 {
+	if p.Count > 0 {
+		return p.Count
+	}
+	if p.Function.IsBit() {
+		return 1
+	}
+	return p.Type.Registers()
+}
+
+// Point is a single named value in a device register map.
+type Point struct {
+	ID        string    `json:"id"`
+	Cap       string    `json:"cap"`
+	Field     string    `json:"field,omitempty"` // key in the state payload, "value" if empty
+	Unit      string    `json:"unit,omitempty"`
+	Addr      uint16    `json:"addr"`
+	Function  Function  `json:"function,omitempty"` // holding if empty
+	Type      DataType  `json:"type,omitempty"`     // int16 if empty
+	Order     ByteOrder `json:"order,omitempty"`    // ABCD if empty
+	Scale     float64   `json:"scale,omitempty"`    // raw / scale, 1 if empty
+	Precision int       `json:"precision,omitempty"`
+	Writable  bool      `json:"writable,omitempty"` // accepts smh/<device>/set/<id>
+	Min       *float64  `json:"min,omitempty"`      // write range, scaled units
+	Max       *float64  `json:"max,omitempty"`
+	// Options labels an enumerated value: the raw value is the index of
+	// its label. Published to Home Assistant as a select.
+	Options []string `json:"options,omitempty"`
+	// Report-by-exception: a value is republished once it moved by
+	// Deadband (scaled units) or DeadbandPct percent of the last published
+	// value, after HeartbeatSec without publishing, but never within
+	// MinIntervalSec of the last publish.
+	Deadband       float64 `json:"deadband,omitempty"`
+	DeadbandPct    float64 `json:"deadband_pct,omitempty"`
+	HeartbeatSec   int     `json:"heartbeat_sec,omitempty"`
+	MinIntervalSec int     `json:"min_interval_sec,omitempty"`
+	// PollMs reads the point at its own interval (INTERVAL_SEC if zero),
+	// PhaseMs later than the interval boundary. Points of a device sharing
+	// both are read together.
+	PollMs  int `json:"poll_ms,omitempty"`
+	PhaseMs int `json:"phase_ms,omitempty"`
+}
+
+type RegMap struct {
+	Points []Point `json:"points"`
+}
+
+// WriteRange returns the write range of the point in scaled units: Min and
+// Max, or the range of its data type where they are not set.
+func (p Point) WriteRange() (lo, hi float64) {
+	param := p.Param()
+	lo, hi = param.Type.Range()
+	lo, hi = lo/param.Scale, hi/param.Scale
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if p.Min != nil {
+		lo = *p.Min
+	}
+	if p.Max != nil {
+		hi = *p.Max
+	}
+	return lo, hi
+}
+
+// Param returns the register parameters needed to read the point.
+func (p Point) Param() RegisterParam {
+	param := RegisterParam{
+		Addr:     p.Addr,
+		Scale:    p.Scale,
+		Function: p.Function,
+		Type:     p.Type,
+		Order:    p.Order,
+	}
+	if param.Scale == 0 {
+		param.Scale = 1
+	}
+	if param.Function == "" {
+		param.Function = FuncHolding
+	}
+	if param.Type == "" {
+		param.Type = TypeInt16
+	}
+	if param.Order == "" {
+		param.Order = OrderABCD
+	}
+	param.Count = param.Registers()
+	return param
+}
+
+// StateField returns the key the point value is published under.
+func (p Point) StateField() string {
+	if p.Field == "" {
+		return "value"
+	}
+	return p.Field
+}
+
+// Caps returns the distinct capabilities of the map in point order.
+func (m RegMap) Caps() []string {
+	var caps []string
+	seen := map[string]bool{}
+	for _, p := range m.Points {
+		if !seen[p.Cap] {
+			seen[p.Cap] = true
+			caps = append(caps, p.Cap)
+		}
+	}
+	return caps
+}
+
+// Reading is the result of reading one RegisterParam in a batch.
+type Reading struct {
+	Value float64
+	Err   error
 }
 
 type Client interface {
 	API
 	ReadFloat(param RegisterParam) (float64, error)
+	// ReadBatch reads all params with as few requests as possible and
+	// returns one Reading per param, in the same order.
+	ReadBatch(params []RegisterParam) []Reading
+	// WriteValue scales value back to raw and writes it to the point.
+	WriteValue(param RegisterParam, value float64) error
+	// Connected reports whether the transport is currently open.
+	Connected() bool
 	Close() error
 }
 
 type API interface {
+	ReadCoils(address, quantity uint16) (results []byte, err error)
+	ReadDiscreteInputs(address, quantity uint16) (results []byte, err error)
 	ReadHoldingRegisters(address, quantity uint16) (results []byte, err error)
 	ReadInputRegisters(address, quantity uint16) (results []byte, err error)
+	WriteSingleCoil(address, value uint16) (results []byte, err error)
+	WriteSingleRegister(address, value uint16) (results []byte, err error)
+	WriteMultipleCoils(address, quantity uint16, value []byte) (results []byte, err error)
+	WriteMultipleRegisters(address, quantity uint16, value []byte) (results []byte, err error)
 }
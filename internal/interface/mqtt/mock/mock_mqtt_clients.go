@@ -75,6 +75,18 @@ func (mr *MockClientMockRecorder) IsConnectionOpen() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsConnectionOpen", reflect.TypeOf((*MockClient)(nil).IsConnectionOpen))
 }
 
+// OnReconnect mocks base method.
+func (m *MockClient) OnReconnect(fn func()) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnReconnect", fn)
+}
+
+// OnReconnect indicates an expected call of OnReconnect.
+func (mr *MockClientMockRecorder) OnReconnect(fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnReconnect", reflect.TypeOf((*MockClient)(nil).OnReconnect), fn)
+}
+
 // Publish mocks base method.
 func (m *MockClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
 	m.ctrl.T.Helper()
@@ -103,6 +115,20 @@ func (mr *MockClientMockRecorder) PublishEvent(message interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishEvent", reflect.TypeOf((*MockClient)(nil).PublishEvent), message)
 }
 
+// StatusTopic mocks base method.
+func (m *MockClient) StatusTopic() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StatusTopic")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// StatusTopic indicates an expected call of StatusTopic.
+func (mr *MockClientMockRecorder) StatusTopic() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StatusTopic", reflect.TypeOf((*MockClient)(nil).StatusTopic))
+}
+
 // Subscribe mocks base method.
 func (m *MockClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
 	m.ctrl.T.Helper()
@@ -18,7 +18,13 @@ type Subscription struct {
 type Client interface {
 	API
 	PublishEvent(message Message) error
+	// SubscribeToTopic subscribes and keeps the subscription across reconnects.
 	SubscribeToTopic(subscription Subscription) error
+	// OnReconnect registers fn to run after the connection is re-established.
+	OnReconnect(fn func())
+	// StatusTopic is the retained online/offline topic of this connection,
+	// set to offline by the broker through the Last Will.
+	StatusTopic() string
 	Close(quiesce uint) error
 }
 
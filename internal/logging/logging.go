@@ -0,0 +1,98 @@
+// Package logging configures the structured logger of the binaries and
+// limits repeating errors.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Setup installs the default slog logger configured by LOG_LEVEL (debug,
+// info, warn or error; default info) and LOG_FORMAT (text or json; default
+// text), writing to stderr.
+func Setup() error {
+	l, err := New(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+	return nil
+}
+
+// New returns a logger writing to w at level in format.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid LOG_FORMAT %q", format)
+}
+
+// Fatal logs msg at error level and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Limiter deduplicates errors that repeat for the same key, e.g. a register
+// failing on every poll: an error is logged when it first occurs or
+// changes, and repeats at most once per interval with the number of
+// suppressed occurrences.
+type Limiter struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	failed map[string]*repeat
+}
+
+type repeat struct {
+	msg        string
+	at         time.Time // last logged
+	suppressed int
+}
+
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval, failed: map[string]*repeat{}}
+}
+
+// Allow reports whether error msg for key should be logged at now, and how
+// many occurrences were suppressed since it was last logged.
+func (l *Limiter) Allow(key, msg string, now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.failed[key]
+	if ok && r.msg == msg && now.Sub(r.at) < l.interval {
+		r.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = r.suppressed
+	}
+	l.failed[key] = &repeat{msg: msg, at: now}
+	return true, suppressed
+}
+
+// Clear forgets key after a success and reports whether it was failing, so
+// the caller can log the recovery.
+func (l *Limiter) Clear(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.failed[key]
+	delete(l.failed, key)
+	return ok
+}
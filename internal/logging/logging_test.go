@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(time.Minute)
+	t0 := time.Unix(1700000000, 0)
+
+	if ok, _ := l.Allow("dev/p1", "timeout", t0); !ok {
+		t.Fatal("first error suppressed")
+	}
+	for i := 1; i <= 3; i++ {
+		if ok, _ := l.Allow("dev/p1", "timeout", t0.Add(time.Duration(i)*time.Second)); ok {
+			t.Fatalf("repeat %d logged", i)
+		}
+	}
+	if ok, _ := l.Allow("dev/p2", "timeout", t0); !ok {
+		t.Error("other key suppressed")
+	}
+	if ok, n := l.Allow("dev/p1", "exception", t0.Add(5*time.Second)); !ok || n != 3 {
+		t.Errorf("changed error: ok=%v suppressed=%d", ok, n)
+	}
+	l.Allow("dev/p1", "exception", t0.Add(6*time.Second))
+	if ok, n := l.Allow("dev/p1", "exception", t0.Add(65*time.Second)); !ok || n != 1 {
+		t.Errorf("after interval: ok=%v suppressed=%d", ok, n)
+	}
+
+	if !l.Clear("dev/p1") || l.Clear("dev/p1") {
+		t.Error("Clear should report a failing key once")
+	}
+	if ok, _ := l.Allow("dev/p1", "exception", t0.Add(66*time.Second)); !ok {
+		t.Error("error after recovery suppressed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("hidden")
+	l.Warn("shown", "device_id", "cw100.inverter")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, `"device_id":"cw100.inverter"`) {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	if _, err := New(&buf, "loud", ""); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if _, err := New(&buf, "", "xml"); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
@@ -0,0 +1,68 @@
+// Package metrics defines the Prometheus metrics of the adapters and core.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// Modbus, labelled by slave, function (coil, discrete, holding, input)
+	// and op (read or write).
+	ModbusRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_modbus_requests_total",
+		Help: "Modbus requests sent.",
+	}, []string{"slave", "function", "op"})
+	ModbusErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_modbus_errors_total",
+		Help: "Failed Modbus requests by kind: timeout, exception or transport.",
+	}, []string{"slave", "function", "op", "kind"})
+	ModbusLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "smh_modbus_request_seconds",
+		Help:    "Modbus request duration.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"slave", "function", "op"})
+	ModbusReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_modbus_reconnects_total",
+		Help: "Modbus transport reconnect attempts by result: ok or failed.",
+	}, []string{"result"})
+
+	// Polling in the adapter.
+	PointValue = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smh_point_value",
+		Help: "Last polled value of a point, in scaled units.",
+	}, []string{"device", "point", "cap"})
+	PollSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_poll_skipped_cycles_total",
+		Help: "Poll cycles skipped because reads overran their slot.",
+	}, []string{"device", "interval"})
+
+	// MQTT, both binaries.
+	MQTTPublishLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smh_mqtt_publish_seconds",
+		Help:    "MQTT publish duration until acknowledged.",
+		Buckets: prometheus.DefBuckets,
+	})
+	MQTTPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "smh_mqtt_publish_failures_total",
+		Help: "MQTT publishes that failed.",
+	})
+
+	// Core.
+	CoreMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_core_messages_total",
+		Help: "Messages received by core by kind: meta, state, availability, retire or ha_status.",
+	}, []string{"kind"})
+	DiscoveryPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smh_discovery_configs_published_total",
+		Help: "Home Assistant discovery configs published by component.",
+	}, []string{"component"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,186 @@
+package profile
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tetragramaton/smh-go/internal/capability"
+	"github.com/tetragramaton/smh-go/internal/interface/modbus"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed profiles/*.yaml
+var builtin embed.FS
+
+// Load reads a register map from a YAML or JSON file and validates it.
+func Load(file string) (modbus.RegMap, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return modbus.RegMap{}, err
+	}
+	m, err := Parse(b)
+	if err != nil {
+		return modbus.RegMap{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return m, nil
+}
+
+// Builtin returns the bundled register map for model (case-insensitive).
+func Builtin(model string) (modbus.RegMap, error) {
+	b, err := builtin.ReadFile("profiles/" + strings.ToLower(model) + ".yaml")
+	if err != nil {
+		return modbus.RegMap{}, fmt.Errorf("no built-in profile for model %q (available: %s)",
+			model, strings.Join(Models(), ", "))
+	}
+	m, err := Parse(b)
+	if err != nil {
+		return modbus.RegMap{}, fmt.Errorf("profile %s: %w", model, err)
+	}
+	return m, nil
+}
+
+// Models lists the bundled profile names.
+func Models() []string {
+	entries, _ := builtin.ReadDir("profiles")
+	models := make([]string, 0, len(entries))
+	for _, e := range entries {
+		models = append(models, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Parse decodes a YAML or JSON register map and validates it. YAML is
+// converted to JSON first so both formats share the json field tags.
+func Parse(b []byte) (modbus.RegMap, error) {
+	var m modbus.RegMap
+	var doc any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return m, err
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return m, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, err
+	}
+	ApplyDefaults(&m)
+	return m, Validate(m)
+}
+
+// ApplyDefaults fills the unit of points of declared capabilities.
+func ApplyDefaults(m *modbus.RegMap) {
+	for i := range m.Points {
+		p := &m.Points[i]
+		capDef, ok := capability.Lookup(p.Cap)
+		if !ok {
+			continue
+		}
+		if f, ok := capDef.Field(p.StateField()); ok && p.Unit == "" {
+			p.Unit = f.Unit
+		}
+	}
+}
+
+// Validate reports every invalid point of the map. IDs, caps, fields and
+// options follow the capability rules, so a valid map yields a meta core
+// accepts.
+func Validate(m modbus.RegMap) error {
+	if len(m.Points) == 0 {
+		return errors.New("register map has no points")
+	}
+	var errs []error
+	if len(m.Points) > capability.MaxPoints {
+		errs = append(errs, fmt.Errorf("more than %d points", capability.MaxPoints))
+	}
+	if caps := m.Caps(); len(caps) > capability.MaxCaps {
+		errs = append(errs, fmt.Errorf("more than %d caps", capability.MaxCaps))
+	}
+	seen := map[string]bool{}
+	fields := map[string]bool{}
+	for i, p := range m.Points {
+		bad := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("point %d (%q): %s", i, p.ID, fmt.Sprintf(format, args...)))
+		}
+		// ids are topic levels in smh/<device>/set/<id>
+		if err := capability.CheckID(p.ID); err != nil {
+			bad("id %v", err)
+		} else if seen[p.ID] {
+			bad("duplicate id")
+		}
+		seen[p.ID] = true
+		if err := capability.CheckField(p.StateField()); err != nil {
+			bad("%v", err)
+		}
+		if p.Cap == "" {
+			bad("missing cap")
+		} else if err := capability.CheckCap(p.Cap); err != nil {
+			bad("%v", err)
+		} else if field := p.Cap + "/" + p.StateField(); fields[field] {
+			bad("duplicate field %q in cap %q", p.StateField(), p.Cap)
+		} else {
+			fields[field] = true
+		}
+		if capDef, ok := capability.Lookup(p.Cap); ok {
+			if f, ok := capDef.Field(p.StateField()); !ok {
+				bad("cap %q has no field %q", p.Cap, p.StateField())
+			} else if p.Unit != f.Unit {
+				bad("unit %q, cap %q expects %q", p.Unit, p.Cap, f.Unit)
+			}
+		}
+		switch p.Function {
+		case "", modbus.FuncHolding, modbus.FuncInput, modbus.FuncCoil, modbus.FuncDiscrete:
+		default:
+			bad("unknown function %q", p.Function)
+		}
+		if p.Type.Registers() == 0 {
+			bad("unknown type %q", p.Type)
+		}
+		switch p.Order {
+		case "", modbus.OrderABCD, modbus.OrderCDAB, modbus.OrderBADC, modbus.OrderDCBA:
+		default:
+			bad("unknown order %q", p.Order)
+		}
+		if int(p.Addr)+int(p.Type.Registers()) > 0x10000 {
+			bad("address %#x out of range", p.Addr)
+		}
+		if p.Precision < 0 {
+			bad("negative precision")
+		}
+		if p.Writable && (p.Function == modbus.FuncInput || p.Function == modbus.FuncDiscrete) {
+			bad("function %q is not writable", p.Function)
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			bad("min %v is greater than max %v", *p.Min, *p.Max)
+		}
+		if p.Deadband < 0 || p.DeadbandPct < 0 {
+			bad("negative deadband")
+		}
+		if p.HeartbeatSec < 0 || p.MinIntervalSec < 0 {
+			bad("negative heartbeat or min interval")
+		}
+		if p.PollMs < 0 || p.PhaseMs < 0 {
+			bad("negative poll interval or phase")
+		}
+		if len(p.Options) > 0 && p.Function.IsBit() {
+			bad("options on a bit point")
+		}
+		for _, o := range p.Options {
+			if err := capability.CheckOption(o); err != nil {
+				bad("%v", err)
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
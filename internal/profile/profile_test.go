@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinProfilesAreValid(t *testing.T) {
+	for _, model := range Models() {
+		if _, err := Builtin(model); err != nil {
+			t.Errorf("%s: %v", model, err)
+		}
+	}
+}
+
+func TestParse_ReportsOffendingPoints(t *testing.T) {
+	src := `
+points:
+  - {id: voltage, cap: sensor.voltage, addr: 0x0000, type: flaot32}
+  - {id: voltage, cap: sensor.voltage, addr: 0x0002, function: coils}
+`
+	_, err := Parse([]byte(src))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{`point 0 ("voltage"): unknown type "flaot32"`, `point 1 ("voltage"): duplicate id`, `unknown function "coils"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestParse_RejectsTopicUnsafeIDs(t *testing.T) {
+	for _, id := range []string{"a/b", "x+", "all#", "power limit"} {
+		src := `{"points":[{"id":"` + id + `","cap":"sensor.voltage","addr":1}]}`
+		if _, err := Parse([]byte(src)); err == nil || !strings.Contains(err.Error(), "may only contain") {
+			t.Errorf("id %q: unexpected error %v", id, err)
+		}
+	}
+}
+
+func TestParse_RejectsWhatCoreRejects(t *testing.T) {
+	for src, want := range map[string]string{
+		`{"points":[{"id":"p","cap":"Sensor.Power","addr":1}]}`:            `invalid cap "Sensor.Power"`,
+		`{"points":[{"id":"p","cap":"meter","field":"x-y","addr":1}]}`:     `invalid field "x-y"`,
+		`{"points":[{"id":"p","cap":"mode","options":["a",""],"addr":1}]}`: `invalid option ""`,
+	} {
+		if _, err := Parse([]byte(src)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestParse_RejectsUnknownFields(t *testing.T) {
+	if _, err := Parse([]byte(`{"points":[{"id":"f","cap":"sensor.frequency","adr":1}]}`)); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestParse_ChecksDeclaredCapabilities(t *testing.T) {
+	m, err := Parse([]byte(`{"points":[{"id":"v","cap":"sensor.voltage","addr":1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Points[0].Unit != "V" {
+		t.Errorf("unit %q, want the capability default V", m.Points[0].Unit)
+	}
+	_, err = Parse([]byte(`{"points":[{"id":"p","cap":"energy.meter","field":"power","unit":"kW","addr":1}]}`))
+	if err == nil || !strings.Contains(err.Error(), `cap "energy.meter" has no field "power"`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}